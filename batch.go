@@ -0,0 +1,183 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// BatchOptions configures DecryptBatch and DecryptStream
+type BatchOptions struct {
+	// Workers is the number of payloads decrypted concurrently. It defaults to GOMAXPROCS,
+	// as each decryption is bound by a CPU-heavy RSA operation.
+	Workers int
+	// Progress, if set, is called after each payload is decrypted. The calls are
+	// never concurrent, but they block the batch, so it should return quickly.
+	Progress func(BatchProgress)
+}
+
+// BatchProgress counts the payloads of a batch decrypted so far
+type BatchProgress struct {
+	// Done counts the payloads decrypted, including the failed ones
+	Done int
+	// Failed counts the payloads whose decryption returned an error
+	Failed int
+	// Total is the size of the batch, or -1 for a stream
+	Total int
+}
+
+// BatchResult is the outcome of decrypting the payload at Index of a batch
+type BatchResult struct {
+	Index int
+	Plain []byte
+	Err   error
+}
+
+func (o BatchOptions) workers() int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// batchProgress serializes the progress reports of the workers
+type batchProgress struct {
+	mu       sync.Mutex
+	progress BatchProgress
+	report   func(BatchProgress)
+}
+
+func (p *batchProgress) add(err error) {
+	if p.report == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Done++
+	if err != nil {
+		p.progress.Failed++
+	}
+	p.report(p.progress)
+}
+
+// DecryptBatch decrypts `payloads` with `d` on a pool of workers. The results are in
+// the order of `payloads`, each carrying its own error. If `ctx` is done before the
+// batch completes, the payloads not yet decrypted are given the context error, which
+// is also returned. A batch whose payloads were all decrypted returns no error.
+func DecryptBatch(ctx context.Context, d Decryptor, payloads [][]byte, opts BatchOptions) ([]BatchResult, error) {
+	cd := ContextDecryptorOf(d)
+	results := make([]BatchResult, len(payloads))
+	decrypted := make([]bool, len(payloads))
+	progress := &batchProgress{progress: BatchProgress{Total: len(payloads)}, report: opts.Progress}
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := range payloads {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.workers(), len(payloads)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				plain, err := cd.Decrypt3DSDataContext(ctx, payloads[i])
+				// each index is taken by a single worker, so the slots are not shared
+				results[i] = BatchResult{Index: i, Plain: plain, Err: err}
+				decrypted[i] = true
+				progress.add(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// a context done once every payload is decrypted leaves the batch complete
+	err := ctx.Err()
+	incomplete := false
+	for i := range results {
+		if !decrypted[i] {
+			results[i] = BatchResult{Index: i, Err: err}
+			incomplete = true
+		}
+	}
+	if incomplete {
+		return results, err
+	}
+	return results, nil
+}
+
+// DecryptStream decrypts the payloads received from `payloads` with `d` on a pool of
+// workers, and sends the results in the order the payloads were received, Index
+// counting from 0. At most BatchOptions.Workers payloads are held at a time, so a slow
+// reader slows down the stream rather than growing it.
+//
+// The returned channel is closed once `payloads` is closed and drained, or once `ctx`
+// is done, in which case the results not yet sent are dropped. The caller must read
+// the channel until it is closed or cancel `ctx`.
+func DecryptStream(ctx context.Context, d Decryptor, payloads <-chan []byte, opts BatchOptions) <-chan BatchResult {
+	type job struct {
+		index   int
+		payload []byte
+		result  chan BatchResult
+	}
+	cd := ContextDecryptorOf(d)
+	workers := opts.workers()
+	jobs := make(chan job)
+	// pending queues the result of each job in the order received, bounding the jobs in flight
+	pending := make(chan chan BatchResult, workers)
+	out := make(chan BatchResult)
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for i := 0; ; i++ {
+			var j job
+			select {
+			case payload, ok := <-payloads:
+				if !ok {
+					return
+				}
+				j = job{index: i, payload: payload, result: make(chan BatchResult, 1)}
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case pending <- j.result:
+			case <-ctx.Done():
+				return
+			}
+			jobs <- j
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for j := range jobs {
+				plain, err := cd.Decrypt3DSDataContext(ctx, j.payload)
+				j.result <- BatchResult{Index: j.index, Plain: plain, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		progress := &batchProgress{progress: BatchProgress{Total: -1}, report: opts.Progress}
+		for result := range pending {
+			r := <-result
+			progress.add(r.Err)
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
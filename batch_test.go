@@ -0,0 +1,173 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// concurrencyProbe records the most calls it had in flight at once
+type concurrencyProbe struct {
+	d        Decryptor
+	inFlight atomic.Int32
+	max      atomic.Int32
+}
+
+func (p *concurrencyProbe) Decrypt3DSData(payload []byte) ([]byte, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		m := p.max.Load()
+		if n <= m || p.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	return p.d.Decrypt3DSData(payload)
+}
+
+func batchPayloads(t *testing.T, n int) (payloads, plains [][]byte) {
+	t.Helper()
+	key := getRSAKey()
+	for i := 0; i < n; i++ {
+		if i%3 == 2 {
+			payloads = append(payloads, []byte("not.a.valid.jwe"))
+			plains = append(plains, nil)
+			continue
+		}
+		jwe, plain := GetMockVisa(key, "106000", "USD")
+		payloads = append(payloads, []byte(jwe))
+		plains = append(plains, plain)
+	}
+	return payloads, plains
+}
+
+func TestDecryptBatch(t *testing.T) {
+	payloads, plains := batchPayloads(t, 12)
+	probe := &concurrencyProbe{d: must(NewJWEDecryptor("100", NewMemoryKeyProvider(getRSAKey())))}
+
+	var reports []BatchProgress
+	results, err := DecryptBatch(context.Background(), probe, payloads, BatchOptions{
+		Workers:  3,
+		Progress: func(p BatchProgress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatalf("DecryptBatch() error = %v", err)
+	}
+	if len(results) != len(payloads) {
+		t.Fatalf("DecryptBatch() returned %d results for %d payloads", len(results), len(payloads))
+	}
+	for i, r := range results {
+		if r.Index != i {
+			t.Errorf("results[%d].Index = %d", i, r.Index)
+		}
+		if plains[i] == nil {
+			if !errors.Is(r.Err, ErrMalformedToken) {
+				t.Errorf("results[%d].Err = %v, want %v", i, r.Err, ErrMalformedToken)
+			}
+			continue
+		}
+		if r.Err != nil || !bytes.Equal(r.Plain, plains[i]) {
+			t.Errorf("results[%d] = %s, %v, want %s", i, r.Plain, r.Err, plains[i])
+		}
+	}
+	if got := probe.max.Load(); got > 3 {
+		t.Errorf("DecryptBatch() ran %d decryptions at once, want at most 3", got)
+	}
+	if last := reports[len(reports)-1]; len(reports) != 12 || last != (BatchProgress{Done: 12, Failed: 4, Total: 12}) {
+		t.Errorf("DecryptBatch() reported %d times, last %+v", len(reports), last)
+	}
+}
+
+func TestDecryptBatchCancelled(t *testing.T) {
+	payloads, _ := batchPayloads(t, 4)
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(getRSAKey())))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := DecryptBatch(ctx, d, payloads, BatchOptions{Workers: 2})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DecryptBatch() error = %v, want %v", err, context.Canceled)
+	}
+	for i, r := range results {
+		if r.Index != i || !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("results[%d] = %d, %v, want the context error", i, r.Index, r.Err)
+		}
+	}
+}
+
+func TestDecryptBatchCancelledOnceComplete(t *testing.T) {
+	payloads, _ := batchPayloads(t, 4)
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(getRSAKey())))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the cancellation lands after the last payload is decrypted
+	results, err := DecryptBatch(ctx, d, payloads, BatchOptions{Workers: 2, Progress: func(p BatchProgress) {
+		if p.Done == p.Total {
+			cancel()
+		}
+	}})
+	if err != nil {
+		t.Fatalf("DecryptBatch() error = %v for a complete batch", err)
+	}
+	for i, r := range results {
+		if errors.Is(r.Err, context.Canceled) {
+			t.Errorf("results[%d] error = %v", i, r.Err)
+		}
+	}
+}
+
+func TestDecryptStream(t *testing.T) {
+	payloads, plains := batchPayloads(t, 9)
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(getRSAKey())))
+
+	in := make(chan []byte)
+	go func() {
+		defer close(in)
+		for _, p := range payloads {
+			in <- p
+		}
+	}()
+	var mu sync.Mutex
+	var last BatchProgress
+	out := DecryptStream(context.Background(), d, in, BatchOptions{
+		Workers: 4,
+		Progress: func(p BatchProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			last = p
+		},
+	})
+
+	i := 0
+	for r := range out {
+		if r.Index != i {
+			t.Fatalf("result %d has Index %d", i, r.Index)
+		}
+		if (r.Err != nil) != (plains[i] == nil) || !bytes.Equal(r.Plain, plains[i]) {
+			t.Errorf("result %d = %s, %v, want %s", i, r.Plain, r.Err, plains[i])
+		}
+		i++
+	}
+	if i != len(payloads) {
+		t.Errorf("DecryptStream() sent %d results for %d payloads", i, len(payloads))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last != (BatchProgress{Done: 9, Failed: 3, Total: -1}) {
+		t.Errorf("DecryptStream() last progress = %+v", last)
+	}
+}
+
+func TestDecryptStreamCancelled(t *testing.T) {
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(getRSAKey())))
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan []byte) // never closed
+	out := DecryptStream(ctx, d, in, BatchOptions{Workers: 2})
+	cancel()
+	for range out {
+	}
+}
@@ -0,0 +1,92 @@
+package samsungpaycodec
+
+import (
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestDetectBrand(t *testing.T) {
+	tests := []struct {
+		pan  string
+		want Brand
+	}{
+		{"4558386640000312", BrandVisa},
+		{"4440000009900010", BrandVisa},
+		{"5214150084269830", BrandMastercard},
+		{"5123456789012346", BrandMastercard},
+		{"2223000048400011", BrandMastercard},
+		{"340353278080900", BrandAmex},
+		{"378282246310005", BrandAmex},
+		{"6011111111111117", BrandDiscover},
+		{"6221260000000000", BrandDiscover},
+		{"6200000000000005", BrandUnionPay},
+		{"3530111333300000", BrandJCB},
+		{"36227206271667", BrandDiners},
+		{"6759649826438453", BrandMaestro},
+		{"2200000000000004", BrandMir},
+		{"5888450000000000", BrandMada},
+		{"4406470000000000", BrandMada},
+		{"9999999999999995", BrandUnknown},
+		{"4111-1111", BrandUnknown},
+		{"", BrandUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pan, func(t *testing.T) {
+			if got := DetectBrand(tt.pan); got != tt.want {
+				t.Errorf("DetectBrand() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePAN(t *testing.T) {
+	tests := []struct {
+		name    string
+		pan     string
+		wantErr bool
+	}{
+		{name: "Visa fixture", pan: "4558386640000312"},
+		{name: "Mastercard fixture", pan: "5214150084269830"},
+		{name: "Amex test card", pan: "340353278080900"},
+		{name: "unknown brand with a valid check digit", pan: "9999999999999995"},
+		{name: "wrong check digit", pan: "4558386640000313", wantErr: true},
+		{name: "Amex of Visa length", pan: "3403532780809009", wantErr: true},
+		{name: "too short", pan: "42424242424", wantErr: true},
+		{name: "spaces", pan: "4558 3866 4000 0312", wantErr: true},
+		{name: "empty", pan: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePAN(tt.pan)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePAN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPAN) {
+				t.Errorf("ValidatePAN() error = %v, want %v", err, ErrInvalidPAN)
+			}
+		})
+	}
+}
+
+func TestMockCardBrands(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	for _, tt := range []struct {
+		mock func(*rsa.PrivateKey, string, string) (string, []byte)
+		want Brand
+	}{
+		{GetMockMastercard, BrandMastercard},
+		{GetMockVisa, BrandVisa},
+		{GetMockAmex, BrandAmex},
+	} {
+		jwe, _ := tt.mock(key, "100", "SAR")
+		pc, err := DecryptCredential(d, []byte(jwe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pc.Brand != tt.want {
+			t.Errorf("mock credential brand = %s, want %s", pc.Brand, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxPayloadSize is the largest compact JWE accepted by the decryptor unless
+// changed with WithMaxPayloadSize. Samsung Pay tokens are around 1 KiB.
+const DefaultMaxPayloadSize = 16 << 10
+
+const (
+	headerIndex = iota
+	encryptionKeyIndex
+	nonceIndex
+	cipherTextIndex
+	tagIndex
+
+	compactParts
+)
+
+// compactJWE is a JWE in compact serialization with its segments decoded
+type compactJWE struct {
+	// rawHeader is the encoded header, which RFC 7516 authenticates as the AAD
+	rawHeader    []byte
+	header       jweHeader
+	encryptedKey []byte
+	iv           []byte
+	ciphertext   []byte
+	tag          []byte
+
+	// buf holds the decoded segments back to back, ciphertext and tag being adjacent
+	buf *[]byte
+}
+
+// decodeBuffers are reused across decryptions for the decoded segments
+var decodeBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 2<<10)
+		return &b
+	},
+}
+
+// maxPooledBuffer keeps the buffers of unusually large payloads out of the pool
+const maxPooledBuffer = DefaultMaxPayloadSize
+
+// parseCompact splits and decodes the payload without trusting its structure. Any
+// deviation from five non-empty base64url segments within `maxSize` is an
+// ErrMalformedToken. The sizes depending on the algorithms are checked by the decryptor.
+//
+// The segments are decoded into a pooled buffer, which the caller hands back with
+// release once done with the decoded values.
+func parseCompact(payload []byte, maxSize int) (compactJWE, error) {
+	if len(payload) == 0 {
+		return compactJWE{}, fmt.Errorf("%w: empty payload", ErrMalformedToken)
+	}
+	if len(payload) > maxSize {
+		return compactJWE{}, fmt.Errorf("%w: payload of %d bytes exceeds the limit of %d", ErrMalformedToken, len(payload), maxSize)
+	}
+	if n := bytes.Count(payload, []byte(".")) + 1; n != compactParts {
+		return compactJWE{}, fmt.Errorf("%w: expected %d segments, found %d", ErrMalformedToken, compactParts, n)
+	}
+	var parts [compactParts][]byte
+	rest := payload
+	for i := range parts[:compactParts-1] {
+		dot := bytes.IndexByte(rest, '.')
+		parts[i], rest = rest[:dot], rest[dot+1:]
+	}
+	parts[tagIndex] = rest
+
+	size := 0
+	for _, part := range parts {
+		size += base64Decoder.DecodedLen(len(part))
+	}
+	buf := decodeBuffers.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	jwe := compactJWE{buf: buf}
+
+	names := [compactParts]string{"header", "encrypted key", "IV", "ciphertext", "authentication tag"}
+	var decoded [compactParts][]byte
+	free := (*buf)[:size]
+	for i, part := range parts {
+		if len(part) == 0 {
+			jwe.release()
+			return compactJWE{}, fmt.Errorf("%w: empty %s", ErrMalformedToken, names[i])
+		}
+		n, err := base64Decoder.Decode(free, part)
+		if err != nil {
+			jwe.release()
+			return compactJWE{}, fmt.Errorf("%w: decoding %s: %w", ErrMalformedToken, names[i], err)
+		}
+		decoded[i], free = free[:n], free[n:]
+	}
+	// cap each segment at its end, except the ciphertext whose capacity covers the tag
+	// following it, see sealedGCM
+	for i, segment := range decoded {
+		extra := 0
+		if i == cipherTextIndex {
+			extra = len(decoded[tagIndex])
+		}
+		decoded[i] = segment[: len(segment) : len(segment)+extra]
+	}
+
+	jwe.rawHeader = parts[headerIndex]
+	jwe.encryptedKey = decoded[encryptionKeyIndex]
+	jwe.iv = decoded[nonceIndex]
+	jwe.ciphertext = decoded[cipherTextIndex]
+	jwe.tag = decoded[tagIndex]
+	if err := json.Unmarshal(decoded[headerIndex], &jwe.header); err != nil {
+		jwe.release()
+		return compactJWE{}, fmt.Errorf("%w: unmarshalling header: %w", ErrMalformedToken, err)
+	}
+	return jwe, nil
+}
+
+// release wipes the buffer of the decoded segments and returns it to the pool. The
+// decoded segments must not be used afterwards.
+func (jwe *compactJWE) release() {
+	if jwe.buf == nil {
+		return
+	}
+	clear((*jwe.buf)[:cap(*jwe.buf)])
+	if cap(*jwe.buf) <= maxPooledBuffer {
+		decodeBuffers.Put(jwe.buf)
+	}
+	*jwe = compactJWE{}
+}
+
+var base64Decoder = base64.RawURLEncoding
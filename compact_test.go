@@ -0,0 +1,141 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseCompact(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+	parts := strings.Split(jwe, ".")
+	tests := []struct {
+		name    string
+		payload string
+		maxSize int
+		wantErr string
+	}{
+		{
+			name:    "mock token is parsed",
+			payload: jwe,
+			maxSize: DefaultMaxPayloadSize,
+		},
+		{
+			name:    "empty payload",
+			payload: "",
+			maxSize: DefaultMaxPayloadSize,
+			wantErr: "empty payload",
+		},
+		{
+			name:    "oversized payload",
+			payload: jwe,
+			maxSize: len(jwe) - 1,
+			wantErr: "exceeds the limit",
+		},
+		{
+			name:    "truncated to four segments",
+			payload: strings.Join(parts[:4], "."),
+			maxSize: DefaultMaxPayloadSize,
+			wantErr: "expected 5 segments, found 4",
+		},
+		{
+			name:    "six segments",
+			payload: jwe + ".AAAA",
+			maxSize: DefaultMaxPayloadSize,
+			wantErr: "expected 5 segments, found 6",
+		},
+		{
+			name:    "empty IV",
+			payload: strings.Join([]string{parts[0], parts[1], "", parts[3], parts[4]}, "."),
+			maxSize: DefaultMaxPayloadSize,
+			wantErr: "empty IV",
+		},
+		{
+			name:    "ciphertext that is not base64url",
+			payload: strings.Join([]string{parts[0], parts[1], parts[2], "a+b/", parts[4]}, "."),
+			maxSize: DefaultMaxPayloadSize,
+			wantErr: "decoding ciphertext",
+		},
+		{
+			name:    "header that is not an object",
+			payload: strings.Join([]string{base64Decoder.EncodeToString([]byte(`["kid"]`)), parts[1], parts[2], parts[3], parts[4]}, "."),
+			maxSize: DefaultMaxPayloadSize,
+			wantErr: "unmarshalling header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCompact([]byte(tt.payload), tt.maxSize)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseCompact() error = %v", err)
+				}
+				if got.header.Kid != Kid(key) || len(got.iv) != 12 || len(got.tag) != 16 || len(got.encryptedKey) != key.Size() {
+					t.Errorf("parseCompact() = %+v", got)
+				}
+				if _, copied := sealedGCM(got.ciphertext, got.tag); copied {
+					t.Error("parseCompact() did not decode the tag right after the ciphertext")
+				}
+				buf := got.buf
+				got.release()
+				if !bytes.Equal(*buf, make([]byte, len(*buf))) {
+					t.Error("release() did not wipe the decoded segments")
+				}
+				return
+			}
+			if !errors.Is(err, ErrMalformedToken) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseCompact() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWERSADecryptorV100RejectsWrongEncryptedKeySize(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+	parts := strings.Split(jwe, ".")
+	parts[encryptionKeyIndex] = parts[encryptionKeyIndex][:len(parts[encryptionKeyIndex])/2]
+	_, err := d.Decrypt3DSData([]byte(strings.Join(parts, ".")))
+	if !errors.Is(err, ErrMalformedToken) || !strings.Contains(err.Error(), "encrypted key") {
+		t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrMalformedToken)
+	}
+}
+
+func FuzzDecrypt3DSData(f *testing.F) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+	parts := strings.Split(jwe, ".")
+	for _, seed := range []string{
+		jwe,
+		"",
+		".",
+		"....",
+		"a.b.c.d.e",
+		strings.Join(parts[:4], "."),
+		strings.Join(parts[:1], "."),
+		jwe + ".",
+		parts[0] + "....",
+		strings.Join([]string{parts[0], parts[1], "AA", parts[3], parts[4]}, "."),
+		strings.Join([]string{parts[0], parts[1], parts[2], "", parts[4]}, "."),
+		strings.Join([]string{parts[0], "AAAA", parts[2], parts[3], parts[4]}, "."),
+	} {
+		f.Add([]byte(seed))
+	}
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		plain, err := d.Decrypt3DSData(payload)
+		if err == nil {
+			if len(plain) == 0 {
+				t.Errorf("Decrypt3DSData() returned neither plaintext nor error")
+			}
+			return
+		}
+		var decryptErr *DecryptError
+		if !errors.As(err, &decryptErr) {
+			t.Errorf("Decrypt3DSData() error = %T, want *DecryptError", err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PaymentCredential is the decrypted 3DS payload of a Samsung Pay token.
+// The values are kept as received; use the accessor methods for typed values.
+type PaymentCredential struct {
+	Amount             string `json:"amount"`
+	CurrencyCode       string `json:"currency_code"`
+	Utc                string `json:"utc"`
+	EciIndicator       string `json:"eci_indicator"`
+	TokenPAN           string `json:"tokenPAN"`
+	TokenPanExpiration string `json:"tokenPanExpiration"`
+	Cryptogram         string `json:"cryptogram"`
+
+	// Brand is detected from TokenPAN when the credential is parsed
+	Brand Brand `json:"-"`
+}
+
+// ParseCredential parses the plaintext produced by a Decryptor.
+func ParseCredential(plain []byte) (*PaymentCredential, error) {
+	var pc PaymentCredential
+	if err := json.Unmarshal(plain, &pc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedCredential, err)
+	}
+	return &pc, nil
+}
+
+// DecryptCredential decrypts the payload using `d` and parses the resulting
+// plaintext into a PaymentCredential.
+func DecryptCredential(d Decryptor, payload []byte) (*PaymentCredential, error) {
+	return DecryptCredentialContext(context.Background(), d, payload)
+}
+
+// DecryptCredentialContext is DecryptCredential carrying `ctx` through the decryption.
+func DecryptCredentialContext(ctx context.Context, d Decryptor, payload []byte) (*PaymentCredential, error) {
+	plain, err := ContextDecryptorOf(d).Decrypt3DSDataContext(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCredential(plain)
+}
+
+// UnmarshalJSON accepts the fields in any order and as either JSON strings
+// or JSON numbers, as both are seen across card networks.
+func (c *PaymentCredential) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Amount             flexString `json:"amount"`
+		CurrencyCode       flexString `json:"currency_code"`
+		Utc                flexString `json:"utc"`
+		EciIndicator       flexString `json:"eci_indicator"`
+		TokenPAN           flexString `json:"tokenPAN"`
+		TokenPanExpiration flexString `json:"tokenPanExpiration"`
+		Cryptogram         flexString `json:"cryptogram"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*c = PaymentCredential{
+		Amount:             string(raw.Amount),
+		CurrencyCode:       string(raw.CurrencyCode),
+		Utc:                string(raw.Utc),
+		EciIndicator:       string(raw.EciIndicator),
+		TokenPAN:           string(raw.TokenPAN),
+		TokenPanExpiration: string(raw.TokenPanExpiration),
+		Cryptogram:         string(raw.Cryptogram),
+		Brand:              DetectBrand(string(raw.TokenPAN)),
+	}
+	return nil
+}
+
+// AmountMinorUnits returns the amount in the minor units of the currency,
+// e.g. cents for USD.
+func (c PaymentCredential) AmountMinorUnits() (int64, error) {
+	amount, err := strconv.ParseInt(strings.TrimSpace(c.Amount), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: parsing amount: %w", ErrMalformedCredential, err)
+	}
+	if amount < 0 {
+		return 0, fmt.Errorf("%w: negative amount: %d", ErrMalformedCredential, amount)
+	}
+	return amount, nil
+}
+
+// Timestamp returns the time the credential was generated, as recorded in
+// the `utc` field in milliseconds since the Unix epoch.
+func (c PaymentCredential) Timestamp() (time.Time, error) {
+	ms, err := strconv.ParseInt(strings.TrimSpace(c.Utc), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: parsing utc: %w", ErrMalformedCredential, err)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// ExpiresAt returns the last instant of the month in which the token expires.
+func (c PaymentCredential) ExpiresAt() (time.Time, error) {
+	exp, err := c.Expiry()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return exp.End(), nil
+}
+
+// Expiry returns the expiration month of the token from `tokenPanExpiration`
+func (c PaymentCredential) Expiry() (TokenExpiry, error) {
+	exp, err := ParseTokenExpiry(c.TokenPanExpiration)
+	if err != nil {
+		return TokenExpiry{}, fmt.Errorf("%w: %w", ErrMalformedCredential, err)
+	}
+	return exp, nil
+}
+
+// flexString decodes a JSON string or number into its textual form.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		return nil
+	case len(b) > 0 && b[0] == '"':
+		var v string
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*s = flexString(v)
+		return nil
+	default:
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return errors.New("expected string or number")
+		}
+		*s = flexString(n)
+		return nil
+	}
+}
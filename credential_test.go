@@ -0,0 +1,137 @@
+package samsungpaycodec
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCredential(t *testing.T) {
+	tests := []struct {
+		name       string
+		plain      []byte
+		want       PaymentCredential
+		wantAmount int64
+		wantTime   time.Time
+		wantExpiry time.Time
+		wantErr    bool
+	}{
+		{
+			name:  "Visa fixture is parsed",
+			plain: []byte(`{"amount":"106000","cryptogram":"AwAABCQACCDLHvYBtQ9EgUUQYaA=","currency_code":"USD","eci_indicator":"05","tokenPanExpiration":"1127","utc":"1700557639934","tokenPAN":"4558386640000312"}`),
+			want: PaymentCredential{
+				Amount:             "106000",
+				CurrencyCode:       "USD",
+				Utc:                "1700557639934",
+				EciIndicator:       "05",
+				TokenPAN:           "4558386640000312",
+				TokenPanExpiration: "1127",
+				Cryptogram:         "AwAABCQACCDLHvYBtQ9EgUUQYaA=",
+				Brand:              BrandVisa,
+			},
+			wantAmount: 106000,
+			wantTime:   time.UnixMilli(1700557639934).UTC(),
+			wantExpiry: time.Date(2027, time.November, 30, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:  "Mastercard fixture is parsed",
+			plain: []byte(`{"amount":"106000","currency_code":"USD","utc":"1700480649483","eci_indicator":"5","tokenPAN":"5214150084269830","tokenPanExpiration":"1126","cryptogram":"AILsL+OF38dxAAQSUy+FAoACFA=="}`),
+			want: PaymentCredential{
+				Amount:             "106000",
+				CurrencyCode:       "USD",
+				Utc:                "1700480649483",
+				EciIndicator:       "5",
+				TokenPAN:           "5214150084269830",
+				TokenPanExpiration: "1126",
+				Cryptogram:         "AILsL+OF38dxAAQSUy+FAoACFA==",
+				Brand:              BrandMastercard,
+			},
+			wantAmount: 106000,
+			wantTime:   time.UnixMilli(1700480649483).UTC(),
+			wantExpiry: time.Date(2026, time.November, 30, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:  "numeric values are accepted",
+			plain: []byte(`{"amount":2500,"currency_code":"SAR","utc":1700480649483,"eci_indicator":2,"tokenPAN":"5123456789012346","tokenPanExpiration":"12/39","cryptogram":"AILsL+OF38dxAAQSUy+FAoACFA=="}`),
+			want: PaymentCredential{
+				Amount:             "2500",
+				CurrencyCode:       "SAR",
+				Utc:                "1700480649483",
+				EciIndicator:       "2",
+				TokenPAN:           "5123456789012346",
+				TokenPanExpiration: "12/39",
+				Cryptogram:         "AILsL+OF38dxAAQSUy+FAoACFA==",
+				Brand:              BrandMastercard,
+			},
+			wantAmount: 2500,
+			wantTime:   time.UnixMilli(1700480649483).UTC(),
+			wantExpiry: time.Date(2039, time.December, 31, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:    "non-scalar values are rejected",
+			plain:   []byte(`{"amount":{"value":"2500"}}`),
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON is rejected",
+			plain:   []byte(`{"amount":`),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCredential(tt.plain)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCredential() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != tt.want {
+				t.Errorf("ParseCredential() = %+v, want %+v", *got, tt.want)
+			}
+			if amount, err := got.AmountMinorUnits(); err != nil || amount != tt.wantAmount {
+				t.Errorf("AmountMinorUnits() = %d, %v, want %d", amount, err, tt.wantAmount)
+			}
+			if ts, err := got.Timestamp(); err != nil || !ts.Equal(tt.wantTime) {
+				t.Errorf("Timestamp() = %s, %v, want %s", ts, err, tt.wantTime)
+			}
+			if exp, err := got.ExpiresAt(); err != nil || !exp.Equal(tt.wantExpiry) {
+				t.Errorf("ExpiresAt() = %s, %v, want %s", exp, err, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestDecryptCredential(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "2500", "SAR")
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+
+	pc, err := DecryptCredential(d, []byte(jwe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.TokenPAN != mastercardTestCard.dpan {
+		t.Errorf("TokenPAN = %s, want %s", pc.TokenPAN, mastercardTestCard.dpan)
+	}
+	if amount, err := pc.AmountMinorUnits(); err != nil || amount != 2500 {
+		t.Errorf("AmountMinorUnits() = %d, %v, want 2500", amount, err)
+	}
+	if pc.CurrencyCode != "SAR" {
+		t.Errorf("CurrencyCode = %s, want SAR", pc.CurrencyCode)
+	}
+}
+
+func TestPaymentCredentialAccessorErrors(t *testing.T) {
+	pc := PaymentCredential{Amount: "-1", Utc: "yesterday", TokenPanExpiration: "1339"}
+	if _, err := pc.AmountMinorUnits(); err == nil {
+		t.Error("AmountMinorUnits() accepted a negative amount")
+	}
+	if _, err := pc.Timestamp(); err == nil {
+		t.Error("Timestamp() accepted a non-numeric utc")
+	}
+	if _, err := pc.ExpiresAt(); err == nil {
+		t.Error("ExpiresAt() accepted month 13")
+	}
+}
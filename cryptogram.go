@@ -0,0 +1,120 @@
+package samsungpaycodec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CryptogramType is the network-specific layout of a token cryptogram
+type CryptogramType string
+
+const (
+	// CryptogramUCAF is the Mastercard Universal Cardholder Authentication Field of a DSRP transaction
+	CryptogramUCAF CryptogramType = "UCAF"
+	// CryptogramDSRP is the full Mastercard DSRP chip data, carried in DE 55 rather than the UCAF
+	CryptogramDSRP CryptogramType = "DSRP"
+	// CryptogramTAVV is the Visa Token Authentication Verification Value
+	CryptogramTAVV CryptogramType = "TAVV"
+	// CryptogramAEVV is the American Express Electronic Verification Value
+	CryptogramAEVV CryptogramType = "AEVV"
+	// CryptogramGeneric is the cryptogram of a brand without a known layout
+	CryptogramGeneric CryptogramType = "generic"
+)
+
+// maxCryptogramSize bounds the decoded cryptogram, the DE 55 chip data of DSRP being the largest
+const maxCryptogramSize = 255
+
+// Cryptogram is the decoded `cryptogram` of a credential
+type Cryptogram struct {
+	Type CryptogramType
+	Raw  []byte
+}
+
+// DecodeCryptogram decodes the base64 `value` and classifies it by the layout of
+// `brand`. The decoded length must be one the brand issues; it returns an
+// ErrInvalidCryptogram otherwise.
+func DecodeCryptogram(value string, brand Brand) (Cryptogram, error) {
+	raw, err := decodeCryptogramBase64(value)
+	if err != nil {
+		return Cryptogram{}, fmt.Errorf("%w: %w", ErrInvalidCryptogram, err)
+	}
+	if len(raw) == 0 || len(raw) > maxCryptogramSize {
+		return Cryptogram{}, fmt.Errorf("%w: length %d", ErrInvalidCryptogram, len(raw))
+	}
+
+	var typ CryptogramType
+	switch brand {
+	case BrandMastercard, BrandMaestro:
+		// the UCAF is 19 or 20 bytes; anything longer is chip data
+		if len(raw) < 19 {
+			return Cryptogram{}, fmt.Errorf("%w: length %d is not issued by %s", ErrInvalidCryptogram, len(raw), brand)
+		}
+		typ = CryptogramDSRP
+		if len(raw) <= 20 {
+			typ = CryptogramUCAF
+		}
+	case BrandVisa, BrandAmex:
+		typ = CryptogramTAVV
+		if brand == BrandAmex {
+			typ = CryptogramAEVV
+		}
+		if !slices.Contains([]int{20, 40}, len(raw)) {
+			return Cryptogram{}, fmt.Errorf("%w: length %d is not issued by %s", ErrInvalidCryptogram, len(raw), brand)
+		}
+	case BrandMada:
+		// the layout is that of the co-brand, which PaymentCredential.DecodeCryptogram
+		// resolves from the PAN; without it only the length common to both is checked
+		if len(raw) < 19 {
+			return Cryptogram{}, fmt.Errorf("%w: length %d is not issued by %s", ErrInvalidCryptogram, len(raw), brand)
+		}
+		typ = CryptogramGeneric
+	default:
+		typ = CryptogramGeneric
+	}
+	return Cryptogram{Type: typ, Raw: raw}, nil
+}
+
+// decodeCryptogramBase64 decodes standard base64, padded or not
+func decodeCryptogramBase64(value string) ([]byte, error) {
+	if strings.HasSuffix(value, "=") || len(value)%4 == 0 {
+		return base64.StdEncoding.Strict().DecodeString(value)
+	}
+	return base64.RawStdEncoding.Strict().DecodeString(value)
+}
+
+// String returns the cryptogram in standard base64
+func (c Cryptogram) String() string {
+	return base64.StdEncoding.EncodeToString(c.Raw)
+}
+
+// NormalizeECI returns the two-digit form of the electronic commerce indicator, e.g.
+// "05" for "5". Samsung Pay sends either form depending on the network.
+func NormalizeECI(eci string) (string, error) {
+	eci = strings.TrimSpace(eci)
+	if len(eci) == 0 || len(eci) > 2 || !allDigits(eci) {
+		return "", fmt.Errorf("%w: invalid ECI '%s'", ErrMalformedCredential, eci)
+	}
+	if len(eci) == 1 {
+		eci = "0" + eci
+	}
+	return eci, nil
+}
+
+// DecodeCryptogram decodes the `cryptogram` of the credential according to its Brand,
+// or to the Visa or Mastercard co-brand of a mada card.
+func (c PaymentCredential) DecodeCryptogram() (Cryptogram, error) {
+	brand := c.Brand
+	if brand == BrandMada && allDigits(c.TokenPAN) {
+		if coBrand := networkBrand(c.TokenPAN); coBrand != BrandUnknown {
+			brand = coBrand
+		}
+	}
+	return DecodeCryptogram(c.Cryptogram, brand)
+}
+
+// ECI returns the two-digit `eci_indicator` of the credential
+func (c PaymentCredential) ECI() (string, error) {
+	return NormalizeECI(c.EciIndicator)
+}
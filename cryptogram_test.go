@@ -0,0 +1,103 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeCryptogram(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		brand   Brand
+		want    CryptogramType
+		wantLen int
+		wantErr error
+	}{
+		{name: "visa fixture", value: "AwAABCQACCDLHvYBtQ9EgUUQYaA=", brand: BrandVisa, want: CryptogramTAVV, wantLen: 20},
+		{name: "mastercard fixture", value: "AILsL+OF38dxAAQSUy+FAoACFA==", brand: BrandMastercard, want: CryptogramUCAF, wantLen: 19},
+		{name: "mastercard chip data", value: testCryptogram, brand: BrandMastercard, want: CryptogramDSRP, wantLen: 40},
+		{name: "amex", value: testCryptogram, brand: BrandAmex, want: CryptogramAEVV, wantLen: 40},
+		{name: "unpadded", value: "AwAABCQACCDLHvYBtQ9EgUUQYaA", brand: BrandVisa, want: CryptogramTAVV, wantLen: 20},
+		{name: "other brand", value: "AQID", brand: BrandDiscover, want: CryptogramGeneric, wantLen: 3},
+		{name: "mada without its co-brand", value: testCryptogram, brand: BrandMada, want: CryptogramGeneric, wantLen: 40},
+		{name: "mada too short", value: "AQID", brand: BrandMada, wantErr: ErrInvalidCryptogram},
+		{name: "visa of 19 bytes", value: "AILsL+OF38dxAAQSUy+FAoACFA==", brand: BrandVisa, wantErr: ErrInvalidCryptogram},
+		{name: "mastercard too short", value: "AQID", brand: BrandMastercard, wantErr: ErrInvalidCryptogram},
+		{name: "not base64", value: "AwAABCQACCDLHvYB!Q9EgUUQYaA=", brand: BrandVisa, wantErr: ErrInvalidCryptogram},
+		{name: "url alphabet", value: "AILsL-OF38dxAAQSUy-FAoACFA==", brand: BrandMastercard, wantErr: ErrInvalidCryptogram},
+		{name: "empty", value: "", brand: BrandVisa, wantErr: ErrInvalidCryptogram},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCryptogram(tt.value, tt.brand)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeCryptogram() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Type != tt.want || len(got.Raw) != tt.wantLen {
+				t.Errorf("DecodeCryptogram() = %s of %d bytes, want %s of %d bytes", got.Type, len(got.Raw), tt.want, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestPaymentCredentialDecodeCryptogram(t *testing.T) {
+	tests := []struct {
+		name       string
+		pan        string
+		cryptogram string
+		want       CryptogramType
+		wantErr    error
+	}{
+		{name: "mada co-branded with visa", pan: "4008610000000000", cryptogram: "AwAABCQACCDLHvYBtQ9EgUUQYaA=", want: CryptogramTAVV},
+		{name: "mada co-branded with mastercard", pan: "5132130000000000", cryptogram: "AILsL+OF38dxAAQSUy+FAoACFA==", want: CryptogramUCAF},
+		{name: "visa layout enforced on mada", pan: "4008610000000000", cryptogram: "AILsL+OF38dxAAQSUy+FAoACFA==", wantErr: ErrInvalidCryptogram},
+		{name: "domestic mada", pan: "9682010000000000", cryptogram: "AILsL+OF38dxAAQSUy+FAoACFA==", want: CryptogramGeneric},
+		{name: "domestic mada too short", pan: "9682010000000000", cryptogram: "AQID", wantErr: ErrInvalidCryptogram},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := PaymentCredential{TokenPAN: tt.pan, Cryptogram: tt.cryptogram, Brand: DetectBrand(tt.pan)}
+			if pc.Brand != BrandMada {
+				t.Fatalf("DetectBrand(%s) = %s, want mada", tt.pan, pc.Brand)
+			}
+			got, err := pc.DecodeCryptogram()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeCryptogram() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.Type != tt.want {
+				t.Errorf("DecodeCryptogram() = %s, want %s", got.Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeECI(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "5", want: "05"},
+		{in: "05", want: "05"},
+		{in: "02", want: "02"},
+		{in: " 7", want: "07"},
+		{in: "", wantErr: true},
+		{in: "105", wantErr: true},
+		{in: "0x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeECI(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeECI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeECI() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package samsungpaycodec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency
+type Currency struct {
+	// Code is the alphabetic code, e.g. "USD"
+	Code string
+	// Numeric is the three-digit numeric code, e.g. "840"
+	Numeric string
+	// Exponent is the number of digits after the decimal separator of the minor unit,
+	// e.g. 2 for USD, 0 for JPY and 3 for KWD
+	Exponent int
+}
+
+// LookupCurrency returns the ISO 4217 currency of the alphabetic or numeric `code`.
+// Alphabetic codes are matched case-insensitively.
+func LookupCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if c, ok := currencies[code]; ok {
+		return c, nil
+	}
+	for _, c := range currencies {
+		if c.Numeric == code {
+			return c, nil
+		}
+	}
+	return Currency{}, fmt.Errorf("%w: '%s'", ErrUnknownCurrency, code)
+}
+
+// Money is an exact amount in the minor units of its currency
+type Money struct {
+	MinorUnits int64
+	Currency   Currency
+}
+
+// NewMoney returns the amount of `minorUnits` in `currency`, e.g. NewMoney(106000, "USD") is 1060.00 USD
+func NewMoney(minorUnits int64, currency string) (Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{MinorUnits: minorUnits, Currency: c}, nil
+}
+
+// ParseMoney reads a decimal amount in major units, e.g. ParseMoney("1.5", "KWD") is
+// 1500 fils. The amount may not have more fraction digits than the currency allows.
+func ParseMoney(decimal, currency string) (Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	s := strings.TrimSpace(decimal)
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > c.Exponent {
+		return Money{}, fmt.Errorf("'%s' has more than %d decimal places allowed for %s", decimal, c.Exponent, c.Code)
+	}
+	if whole == "" || whole == "-" || whole == "+" || strings.ContainsAny(frac, "+-") {
+		return Money{}, fmt.Errorf("invalid decimal amount '%s'", decimal)
+	}
+	minor, err := strconv.ParseInt(whole+frac+strings.Repeat("0", c.Exponent-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid decimal amount '%s': %w", decimal, err)
+	}
+	return Money{MinorUnits: minor, Currency: c}, nil
+}
+
+// Decimal formats the amount in major units with the exponent of the currency, e.g. "1060.00"
+func (m Money) Decimal() string {
+	digits := strconv.FormatInt(m.MinorUnits, 10)
+	sign := ""
+	if m.MinorUnits < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if m.Currency.Exponent == 0 {
+		return sign + digits
+	}
+	if pad := m.Currency.Exponent + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - m.Currency.Exponent
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// String formats the amount followed by the currency code, e.g. "1060.00 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency.Code
+}
+
+// Money returns the amount of the credential in its currency
+func (c PaymentCredential) Money() (Money, error) {
+	minor, err := c.AmountMinorUnits()
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(minor, c.CurrencyCode)
+}
+
+// currencies is the ISO 4217 list of active currencies, keyed by alphabetic code.
+// Funds and precious metals are omitted as they are not used in card payments.
+var currencies = map[string]Currency{
+	"AED": {"AED", "784", 2},
+	"AFN": {"AFN", "971", 2},
+	"ALL": {"ALL", "008", 2},
+	"AMD": {"AMD", "051", 2},
+	"AOA": {"AOA", "973", 2},
+	"ARS": {"ARS", "032", 2},
+	"AUD": {"AUD", "036", 2},
+	"AWG": {"AWG", "533", 2},
+	"AZN": {"AZN", "944", 2},
+	"BAM": {"BAM", "977", 2},
+	"BBD": {"BBD", "052", 2},
+	"BDT": {"BDT", "050", 2},
+	"BGN": {"BGN", "975", 2},
+	"BHD": {"BHD", "048", 3},
+	"BIF": {"BIF", "108", 0},
+	"BMD": {"BMD", "060", 2},
+	"BND": {"BND", "096", 2},
+	"BOB": {"BOB", "068", 2},
+	"BRL": {"BRL", "986", 2},
+	"BSD": {"BSD", "044", 2},
+	"BTN": {"BTN", "064", 2},
+	"BWP": {"BWP", "072", 2},
+	"BYN": {"BYN", "933", 2},
+	"BZD": {"BZD", "084", 2},
+	"CAD": {"CAD", "124", 2},
+	"CDF": {"CDF", "976", 2},
+	"CHF": {"CHF", "756", 2},
+	"CLP": {"CLP", "152", 0},
+	"CNY": {"CNY", "156", 2},
+	"COP": {"COP", "170", 2},
+	"CRC": {"CRC", "188", 2},
+	"CUP": {"CUP", "192", 2},
+	"CVE": {"CVE", "132", 2},
+	"CZK": {"CZK", "203", 2},
+	"DJF": {"DJF", "262", 0},
+	"DKK": {"DKK", "208", 2},
+	"DOP": {"DOP", "214", 2},
+	"DZD": {"DZD", "012", 2},
+	"EGP": {"EGP", "818", 2},
+	"ERN": {"ERN", "232", 2},
+	"ETB": {"ETB", "230", 2},
+	"EUR": {"EUR", "978", 2},
+	"FJD": {"FJD", "242", 2},
+	"FKP": {"FKP", "238", 2},
+	"GBP": {"GBP", "826", 2},
+	"GEL": {"GEL", "981", 2},
+	"GHS": {"GHS", "936", 2},
+	"GIP": {"GIP", "292", 2},
+	"GMD": {"GMD", "270", 2},
+	"GNF": {"GNF", "324", 0},
+	"GTQ": {"GTQ", "320", 2},
+	"GYD": {"GYD", "328", 2},
+	"HKD": {"HKD", "344", 2},
+	"HNL": {"HNL", "340", 2},
+	"HTG": {"HTG", "332", 2},
+	"HUF": {"HUF", "348", 2},
+	"IDR": {"IDR", "360", 2},
+	"ILS": {"ILS", "376", 2},
+	"INR": {"INR", "356", 2},
+	"IQD": {"IQD", "368", 3},
+	"IRR": {"IRR", "364", 2},
+	"ISK": {"ISK", "352", 0},
+	"JMD": {"JMD", "388", 2},
+	"JOD": {"JOD", "400", 3},
+	"JPY": {"JPY", "392", 0},
+	"KES": {"KES", "404", 2},
+	"KGS": {"KGS", "417", 2},
+	"KHR": {"KHR", "116", 2},
+	"KMF": {"KMF", "174", 0},
+	"KPW": {"KPW", "408", 2},
+	"KRW": {"KRW", "410", 0},
+	"KWD": {"KWD", "414", 3},
+	"KYD": {"KYD", "136", 2},
+	"KZT": {"KZT", "398", 2},
+	"LAK": {"LAK", "418", 2},
+	"LBP": {"LBP", "422", 2},
+	"LKR": {"LKR", "144", 2},
+	"LRD": {"LRD", "430", 2},
+	"LSL": {"LSL", "426", 2},
+	"LYD": {"LYD", "434", 3},
+	"MAD": {"MAD", "504", 2},
+	"MDL": {"MDL", "498", 2},
+	"MGA": {"MGA", "969", 2},
+	"MKD": {"MKD", "807", 2},
+	"MMK": {"MMK", "104", 2},
+	"MNT": {"MNT", "496", 2},
+	"MOP": {"MOP", "446", 2},
+	"MRU": {"MRU", "929", 2},
+	"MUR": {"MUR", "480", 2},
+	"MVR": {"MVR", "462", 2},
+	"MWK": {"MWK", "454", 2},
+	"MXN": {"MXN", "484", 2},
+	"MYR": {"MYR", "458", 2},
+	"MZN": {"MZN", "943", 2},
+	"NAD": {"NAD", "516", 2},
+	"NGN": {"NGN", "566", 2},
+	"NIO": {"NIO", "558", 2},
+	"NOK": {"NOK", "578", 2},
+	"NPR": {"NPR", "524", 2},
+	"NZD": {"NZD", "554", 2},
+	"OMR": {"OMR", "512", 3},
+	"PAB": {"PAB", "590", 2},
+	"PEN": {"PEN", "604", 2},
+	"PGK": {"PGK", "598", 2},
+	"PHP": {"PHP", "608", 2},
+	"PKR": {"PKR", "586", 2},
+	"PLN": {"PLN", "985", 2},
+	"PYG": {"PYG", "600", 0},
+	"QAR": {"QAR", "634", 2},
+	"RON": {"RON", "946", 2},
+	"RSD": {"RSD", "941", 2},
+	"RUB": {"RUB", "643", 2},
+	"RWF": {"RWF", "646", 0},
+	"SAR": {"SAR", "682", 2},
+	"SBD": {"SBD", "090", 2},
+	"SCR": {"SCR", "690", 2},
+	"SDG": {"SDG", "938", 2},
+	"SEK": {"SEK", "752", 2},
+	"SGD": {"SGD", "702", 2},
+	"SHP": {"SHP", "654", 2},
+	"SLE": {"SLE", "925", 2},
+	"SOS": {"SOS", "706", 2},
+	"SRD": {"SRD", "968", 2},
+	"SSP": {"SSP", "728", 2},
+	"STN": {"STN", "930", 2},
+	"SVC": {"SVC", "222", 2},
+	"SYP": {"SYP", "760", 2},
+	"SZL": {"SZL", "748", 2},
+	"THB": {"THB", "764", 2},
+	"TJS": {"TJS", "972", 2},
+	"TMT": {"TMT", "934", 2},
+	"TND": {"TND", "788", 3},
+	"TOP": {"TOP", "776", 2},
+	"TRY": {"TRY", "949", 2},
+	"TTD": {"TTD", "780", 2},
+	"TWD": {"TWD", "901", 2},
+	"TZS": {"TZS", "834", 2},
+	"UAH": {"UAH", "980", 2},
+	"UGX": {"UGX", "800", 0},
+	"USD": {"USD", "840", 2},
+	"UYU": {"UYU", "858", 2},
+	"UZS": {"UZS", "860", 2},
+	"VED": {"VED", "926", 2},
+	"VES": {"VES", "928", 2},
+	"VND": {"VND", "704", 0},
+	"VUV": {"VUV", "548", 0},
+	"WST": {"WST", "882", 2},
+	"XAF": {"XAF", "950", 0},
+	"XCD": {"XCD", "951", 2},
+	"XCG": {"XCG", "532", 2},
+	"XOF": {"XOF", "952", 0},
+	"XPF": {"XPF", "953", 0},
+	"YER": {"YER", "886", 2},
+	"ZAR": {"ZAR", "710", 2},
+	"ZMW": {"ZMW", "967", 2},
+	"ZWG": {"ZWG", "924", 2},
+}
@@ -0,0 +1,101 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    Currency
+		wantErr error
+	}{
+		{code: "USD", want: Currency{"USD", "840", 2}},
+		{code: "sar", want: Currency{"SAR", "682", 2}},
+		{code: "392", want: Currency{"JPY", "392", 0}},
+		{code: "KWD", want: Currency{"KWD", "414", 3}},
+		{code: "XXX", wantErr: ErrUnknownCurrency},
+		{code: "CLF", wantErr: ErrUnknownCurrency},
+		{code: "", wantErr: ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := LookupCurrency(tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LookupCurrency() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LookupCurrency() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		decimal  string
+		currency string
+		want     int64
+		wantStr  string
+		wantErr  bool
+	}{
+		{name: "two decimals", decimal: "1060.00", currency: "USD", want: 106000, wantStr: "1060.00 USD"},
+		{name: "fewer decimals than the exponent", decimal: "1.5", currency: "KWD", want: 1500, wantStr: "1.500 KWD"},
+		{name: "zero decimals", decimal: "1060", currency: "JPY", want: 1060, wantStr: "1060 JPY"},
+		{name: "sub-unit amount", decimal: "0.05", currency: "BHD", want: 50, wantStr: "0.050 BHD"},
+		{name: "negative amount", decimal: "-0.5", currency: "EUR", want: -50, wantStr: "-0.50 EUR"},
+		{name: "too many decimals", decimal: "10.5", currency: "JPY", wantErr: true},
+		{name: "not a number", decimal: "ten", currency: "USD", wantErr: true},
+		{name: "missing whole part", decimal: ".5", currency: "USD", wantErr: true},
+		{name: "signed missing whole part", decimal: "+.5", currency: "USD", wantErr: true},
+		{name: "unknown currency", decimal: "1", currency: "ABC", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.decimal, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.MinorUnits != tt.want || got.String() != tt.wantStr {
+				t.Errorf("ParseMoney() = %d (%s), want %d (%s)", got.MinorUnits, got, tt.want, tt.wantStr)
+			}
+		})
+	}
+}
+
+func TestPaymentCredentialMoney(t *testing.T) {
+	got, err := PaymentCredential{Amount: "106000", CurrencyCode: "USD"}.Money()
+	if err != nil || got.String() != "1060.00 USD" {
+		t.Errorf("Money() = %s, %v, want 1060.00 USD", got, err)
+	}
+	if _, err := (PaymentCredential{Amount: "100", CurrencyCode: "US"}).Money(); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("Money() error = %v, want %v", err, ErrUnknownCurrency)
+	}
+}
+
+func TestMockAmounts(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	for _, tt := range []struct {
+		amount, currency, want string
+	}{
+		{"1.5", "KWD", "1500"},
+		{"1500", "JPY", "1500"},
+		{"1500.", "JPY", "1500"},
+		{"10.25", "SAR", "1025"},
+	} {
+		jwe, _ := GetMockMastercard(key, tt.amount, tt.currency)
+		pc, err := DecryptCredential(d, []byte(jwe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pc.Amount != tt.want {
+			t.Errorf("GetMockMastercard(%s %s) amount = %s, want %s", tt.amount, tt.currency, pc.Amount, tt.want)
+		}
+	}
+}
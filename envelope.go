@@ -0,0 +1,74 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope is the payment credential handed to the merchant by the Samsung Pay SDK.
+// The encrypted card data is the JWE in ThreeDS.Data.
+type Envelope struct {
+	Method           string      `json:"method"`
+	CardBrand        string      `json:"card_brand"`
+	CardLast4Digits  string      `json:"card_last4digits"`
+	RecurringPayment bool        `json:"recurring_payment"`
+	ThreeDS          ThreeDSData `json:"3DS"`
+}
+
+// ThreeDSData carries the encrypted payload and the version of the spec it was produced with
+type ThreeDSData struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Data    string `json:"data"`
+}
+
+// ParseEnvelope parses the SDK credential JSON. It does not decrypt the 3DS data.
+func ParseEnvelope(b []byte) (*Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedEnvelope, err)
+	}
+	if e.ThreeDS.Version == "" {
+		return nil, fmt.Errorf("%w: missing 3DS version", ErrMalformedEnvelope)
+	}
+	if e.ThreeDS.Data == "" {
+		return nil, fmt.Errorf("%w: missing 3DS data", ErrMalformedEnvelope)
+	}
+	return &e, nil
+}
+
+// DecryptorForVersion returns the decryptor of a spec version. It lets DecryptEnvelope
+// use decryptors wrapped by the caller, e.g. with NewReplayGuard.
+type DecryptorForVersion func(version string) (Decryptor, error)
+
+// JWEDecryptors returns the DecryptorForVersion producing the registered decryptors
+// with NewJWEDecryptor, using `provider` for key retrieval.
+func JWEDecryptors(provider KeyProvider, opts ...DecryptorOption) DecryptorForVersion {
+	return func(version string) (Decryptor, error) {
+		return NewJWEDecryptor(version, provider, opts...)
+	}
+}
+
+// DecryptEnvelope parses the SDK credential JSON and decrypts its 3DS data with the
+// decryptor `decryptorFor` returns for the version stated in the envelope.
+func DecryptEnvelope(b []byte, decryptorFor DecryptorForVersion) (*Envelope, *PaymentCredential, error) {
+	return DecryptEnvelopeContext(context.Background(), b, decryptorFor)
+}
+
+// DecryptEnvelopeContext is DecryptEnvelope carrying `ctx` through the decryption.
+func DecryptEnvelopeContext(ctx context.Context, b []byte, decryptorFor DecryptorForVersion) (*Envelope, *PaymentCredential, error) {
+	e, err := ParseEnvelope(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := decryptorFor(e.ThreeDS.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	pc, err := DecryptCredentialContext(ctx, d, []byte(e.ThreeDS.Data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return e, pc, nil
+}
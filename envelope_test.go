@@ -0,0 +1,91 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       string
+		want    Envelope
+		wantErr error
+	}{
+		{
+			name: "SDK credential is parsed",
+			b:    `{"method":"3DS","recurring_payment":false,"card_brand":"VI","card_last4digits":"0312","3DS":{"type":"S","version":"100","data":"a.b.c.d.e"}}`,
+			want: Envelope{
+				Method:          "3DS",
+				CardBrand:       "VI",
+				CardLast4Digits: "0312",
+				ThreeDS:         ThreeDSData{Type: "S", Version: "100", Data: "a.b.c.d.e"},
+			},
+		},
+		{
+			name:    "missing version",
+			b:       `{"method":"3DS","3DS":{"type":"S","data":"a.b.c.d.e"}}`,
+			wantErr: ErrMalformedEnvelope,
+		},
+		{
+			name:    "missing data",
+			b:       `{"method":"3DS","3DS":{"type":"S","version":"100"}}`,
+			wantErr: ErrMalformedEnvelope,
+		},
+		{
+			name:    "not JSON",
+			b:       `eyJhbGciOiJSU0ExXzUi`,
+			wantErr: ErrMalformedEnvelope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnvelope([]byte(tt.b))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseEnvelope() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("ParseEnvelope() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecryptEnvelope(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockVisa(key, "2500", "SAR")
+	envelope := func(version string) []byte {
+		return []byte(fmt.Sprintf(`{"method":"3DS","recurring_payment":true,"card_brand":"VI","card_last4digits":"0010","3DS":{"type":"S","version":"%s","data":"%s"}}`, version, jwe))
+	}
+
+	e, pc, err := DecryptEnvelope(envelope("100"), JWEDecryptors(NewMemoryKeyProvider(key), WithHeaderPolicy(SamsungPayHeaderPolicy())))
+	if err != nil {
+		t.Fatalf("DecryptEnvelope() error = %v", err)
+	}
+	if e.CardBrand != "VI" || e.CardLast4Digits != "0010" || !e.RecurringPayment {
+		t.Errorf("DecryptEnvelope() envelope = %+v", e)
+	}
+	if pc.TokenPAN != visaTestCard.dpan || pc.Amount != "2500" {
+		t.Errorf("DecryptEnvelope() credential = %+v", pc)
+	}
+
+	if _, _, err := DecryptEnvelope(envelope("200"), JWEDecryptors(NewMemoryKeyProvider(key))); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("DecryptEnvelope() error = %v, want %v", err, ErrUnsupportedVersion)
+	}
+	if _, _, err := DecryptEnvelope(envelope("100"), JWEDecryptors(NewMemoryKeyProvider())); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("DecryptEnvelope() error = %v, want %v", err, ErrKeyNotFound)
+	}
+
+	// the caller may wrap the decryptor, here to reject the second submission
+	guarded := NewReplayGuard(must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))), ReplayPolicy{Store: NewMemoryReplayStore()})
+	decryptorFor := func(version string) (Decryptor, error) {
+		return guarded, nil
+	}
+	if _, _, err := DecryptEnvelope(envelope("100"), decryptorFor); err != nil {
+		t.Fatalf("DecryptEnvelope() error = %v", err)
+	}
+	if _, _, err := DecryptEnvelope(envelope("100"), decryptorFor); !errors.Is(err, ErrReplayDetected) {
+		t.Errorf("DecryptEnvelope() error = %v, want %v", err, ErrReplayDetected)
+	}
+}
@@ -0,0 +1,69 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors for the decryption failures. They are matched with errors.Is,
+// whether returned directly or wrapped in a *DecryptError.
+var (
+	ErrUnsupportedVersion   = errors.New("version not supported")
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	ErrHeaderPolicy         = errors.New("header policy violation")
+	ErrKeyNotFound          = errors.New("key not found")
+	ErrInvalidKey           = errors.New("invalid key")
+	ErrKeyUnwrapFailed      = errors.New("key unwrap failed")
+	ErrAuthenticationFailed = errors.New("authentication failed")
+	ErrMalformedCredential  = errors.New("malformed payment credential")
+	ErrMalformedEnvelope    = errors.New("malformed credential envelope")
+	ErrStaleCredential      = errors.New("credential too old")
+	ErrFutureCredential     = errors.New("credential from the future")
+	ErrReplayDetected       = errors.New("token already used")
+	ErrOrderMismatch        = errors.New("credential does not match the order")
+	ErrUnknownCurrency      = errors.New("unknown currency")
+	ErrInvalidPAN           = errors.New("invalid PAN")
+	ErrTokenExpired         = errors.New("token expired")
+	ErrInvalidCryptogram    = errors.New("invalid cryptogram")
+)
+
+// Stage names the step of the decryption pipeline at which a failure occurred
+type Stage string
+
+const (
+	// StageParse is the decoding of the compact serialization and the header
+	StageParse Stage = "parse"
+	// StageHeader is the validation of the header against the policy and supported algorithms
+	StageHeader Stage = "header"
+	// StageKeyLookup is the retrieval of the private key from the KeyProvider
+	StageKeyLookup Stage = "key_lookup"
+	// StageKeyUnwrap is the decryption of the content encryption key
+	StageKeyUnwrap Stage = "key_unwrap"
+	// StageContentDecrypt is the decryption and authentication of the ciphertext
+	StageContentDecrypt Stage = "content_decrypt"
+	// StageValidate is the validation of the decrypted credential, e.g. its expiry
+	StageValidate Stage = "validate"
+	// StageReplay is the replay check of the decrypted credential, see NewReplayGuard
+	StageReplay Stage = "replay"
+)
+
+// DecryptError records the stage at which decryption failed and the kid of the
+// token, if it was read. The underlying error is one of the sentinel errors,
+// possibly wrapping further detail.
+type DecryptError struct {
+	Stage Stage
+	Kid   string
+	Err   error
+}
+
+func (e *DecryptError) Error() string {
+	if e.Kid == "" {
+		return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("%s (kid '%s'): %v", e.Stage, e.Kid, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,125 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecryptErrors(t *testing.T) {
+	key := getRSAKey()
+	kid := Kid(key)
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+	parts := strings.Split(jwe, ".")
+	replace := func(index int, value string) []byte {
+		p := append([]string{}, parts...)
+		p[index] = value
+		return []byte(strings.Join(p, "."))
+	}
+	flip := func(index int) []byte {
+		bs, _ := base64Decoder.DecodeString(parts[index])
+		bs[len(bs)/2] ^= 0xff
+		return replace(index, base64Decoder.EncodeToString(bs))
+	}
+	header := mockHeader(&key.PublicKey)
+	header.Kid = "unknown"
+	unknownKid, _ := mockJWE(header, &key.PublicKey, mockCredential(mastercardTestCard, "100", "SAR"))
+
+	tests := []struct {
+		name      string
+		d         Decryptor
+		payload   []byte
+		wantErr   error
+		wantStage Stage
+		wantKid   string
+	}{
+		{
+			name:      "header that is not base64",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))),
+			payload:   replace(headerIndex, "!!!"),
+			wantErr:   ErrMalformedToken,
+			wantStage: StageParse,
+		},
+		{
+			name:      "header that is not JSON",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))),
+			payload:   replace(headerIndex, base64Decoder.EncodeToString([]byte("kid"))),
+			wantErr:   ErrMalformedToken,
+			wantStage: StageParse,
+		},
+		{
+			name:      "header rejected by policy",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key), WithHeaderPolicy(HeaderPolicy{Types: []string{"JWE"}}))),
+			payload:   []byte(jwe),
+			wantErr:   ErrHeaderPolicy,
+			wantStage: StageHeader,
+			wantKid:   kid,
+		},
+		{
+			name:      "unknown kid",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))),
+			payload:   []byte(unknownKid),
+			wantErr:   ErrKeyNotFound,
+			wantStage: StageKeyLookup,
+			wantKid:   "unknown",
+		},
+		{
+			name:      "IV of the wrong size",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))),
+			payload:   replace(nonceIndex, base64Decoder.EncodeToString(make([]byte, 16))),
+			wantErr:   ErrMalformedToken,
+			wantStage: StageParse,
+			wantKid:   kid,
+		},
+		{
+			name:      "tampered encrypted key",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))),
+			payload:   flip(encryptionKeyIndex),
+			wantErr:   ErrAuthenticationFailed,
+			wantStage: StageContentDecrypt,
+			wantKid:   kid,
+		},
+		{
+			name:      "tampered ciphertext",
+			d:         must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))),
+			payload:   flip(cipherTextIndex),
+			wantErr:   ErrAuthenticationFailed,
+			wantStage: StageContentDecrypt,
+			wantKid:   kid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.d.Decrypt3DSData(tt.payload)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decrypt3DSData() error = %v, want %v", err, tt.wantErr)
+			}
+			var decryptErr *DecryptError
+			if !errors.As(err, &decryptErr) {
+				t.Fatalf("Decrypt3DSData() error = %T, want *DecryptError", err)
+			}
+			if decryptErr.Stage != tt.wantStage {
+				t.Errorf("DecryptError.Stage = %s, want %s", decryptErr.Stage, tt.wantStage)
+			}
+			if decryptErr.Kid != tt.wantKid {
+				t.Errorf("DecryptError.Kid = %s, want %s", decryptErr.Kid, tt.wantKid)
+			}
+		})
+	}
+}
+
+func TestUnsupportedVersionError(t *testing.T) {
+	_, err := NewJWEDecryptor("101", NewMemoryKeyProvider(getRSAKey()))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("NewJWEDecryptor() error = %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestMalformedCredentialError(t *testing.T) {
+	if _, err := ParseCredential([]byte("{")); !errors.Is(err, ErrMalformedCredential) {
+		t.Errorf("ParseCredential() error = %v, want %v", err, ErrMalformedCredential)
+	}
+	if _, err := (PaymentCredential{Amount: "ten"}).AmountMinorUnits(); !errors.Is(err, ErrMalformedCredential) {
+		t.Errorf("AmountMinorUnits() error = %v, want %v", err, ErrMalformedCredential)
+	}
+}
@@ -0,0 +1,50 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenExpiry is the month through which a token is valid
+type TokenExpiry struct {
+	Month time.Month
+	// Year is the four-digit year
+	Year int
+}
+
+// ParseTokenExpiry reads the MMYY format of `tokenPanExpiration`, e.g. "1127" for
+// November 2027. The MM/YY form is accepted as well.
+func ParseTokenExpiry(s string) (TokenExpiry, error) {
+	exp := strings.TrimSpace(s)
+	if len(exp) == 5 && exp[2] == '/' {
+		exp = exp[:2] + exp[3:]
+	}
+	if len(exp) != 4 || !allDigits(exp) {
+		return TokenExpiry{}, errors.New("invalid token expiration")
+	}
+	month, _ := strconv.Atoi(exp[:2])
+	if month < 1 || month > 12 {
+		return TokenExpiry{}, errors.New("invalid token expiration month")
+	}
+	year, _ := strconv.Atoi(exp[2:])
+	return TokenExpiry{Month: time.Month(month), Year: 2000 + year}, nil
+}
+
+// End returns the last instant of the expiration month in UTC
+func (e TokenExpiry) End() time.Time {
+	// first instant of the following month, minus the smallest tick
+	return time.Date(e.Year, e.Month+1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)
+}
+
+// Expired reports whether the expiration month has passed at `now`
+func (e TokenExpiry) Expired(now time.Time) bool {
+	return now.After(e.End())
+}
+
+// String formats the expiry as MM/YY
+func (e TokenExpiry) String() string {
+	return fmt.Sprintf("%02d/%02d", int(e.Month), e.Year%100)
+}
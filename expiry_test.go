@@ -0,0 +1,86 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTokenExpiry(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    TokenExpiry
+		wantEnd time.Time
+		wantErr bool
+	}{
+		{in: "1127", want: TokenExpiry{Month: time.November, Year: 2027}, wantEnd: time.Date(2027, time.November, 30, 23, 59, 59, 999999999, time.UTC)},
+		{in: "0139", want: TokenExpiry{Month: time.January, Year: 2039}, wantEnd: time.Date(2039, time.January, 31, 23, 59, 59, 999999999, time.UTC)},
+		{in: "02/28", want: TokenExpiry{Month: time.February, Year: 2028}, wantEnd: time.Date(2028, time.February, 29, 23, 59, 59, 999999999, time.UTC)},
+		{in: "1230", want: TokenExpiry{Month: time.December, Year: 2030}, wantEnd: time.Date(2030, time.December, 31, 23, 59, 59, 999999999, time.UTC)},
+		{in: "1327", wantErr: true},
+		{in: "0027", wantErr: true},
+		{in: "127", wantErr: true},
+		{in: "11+7", wantErr: true},
+		{in: "1/127", wantErr: true},
+		{in: "112/7", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTokenExpiry(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTokenExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseTokenExpiry() = %+v, want %+v", got, tt.want)
+			}
+			if !got.End().Equal(tt.wantEnd) {
+				t.Errorf("End() = %s, want %s", got.End(), tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestTokenExpiryExpired(t *testing.T) {
+	exp := TokenExpiry{Month: time.November, Year: 2027}
+	if exp.Expired(time.Date(2027, time.November, 30, 23, 59, 0, 0, time.UTC)) {
+		t.Error("Expired() on the last day of the month")
+	}
+	if !exp.Expired(time.Date(2027, time.December, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expired() = false after the month ended")
+	}
+	if got := exp.String(); got != "11/27" {
+		t.Errorf("String() = %s, want 11/27", got)
+	}
+}
+
+func TestWithExpiryCheck(t *testing.T) {
+	key := getRSAKey()
+	provider := NewMemoryKeyProvider(key)
+	jwe, _ := GetMockMastercard(key, "106000", "USD") // expires 01/39
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "before expiry", now: time.Date(2039, time.January, 31, 12, 0, 0, 0, time.UTC)},
+		{name: "after expiry", now: time.Date(2039, time.February, 1, 0, 0, 0, 0, time.UTC), wantErr: ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := must(NewJWEDecryptor("100", provider, WithExpiryCheck(func() time.Time { return tt.now })))
+			_, err := d.Decrypt3DSData([]byte(jwe))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decrypt3DSData() error = %v, want %v", err, tt.wantErr)
+			}
+			var de *DecryptError
+			if tt.wantErr != nil && (!errors.As(err, &de) || de.Stage != StageValidate) {
+				t.Errorf("Decrypt3DSData() error = %v, want stage %s", err, StageValidate)
+			}
+		})
+	}
+}
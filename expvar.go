@@ -0,0 +1,90 @@
+package samsungpaycodec
+
+import (
+	"expvar"
+)
+
+// NewExpvarObserver returns an Observer publishing its counters as a map named
+// `name` in expvar, served at /debug/vars. It panics if `name` is already
+// published, like expvar.NewMap. The map holds:
+//
+//   - decryptions_started, decryptions_succeeded, decryptions_failed and
+//     decryptions_in_flight
+//   - decryption_seconds_total, the time spent decrypting
+//   - decryptions_by_kid and decryptions_by_brand, counting the finished decryptions
+//   - failures_by_kid and failures_by_stage
+//   - key_lookups_by_result, counting hits, misses and errors, and key_misses_by_kid
+//
+// A kid is only broken out once a lookup found its key; the others count as "unknown".
+func NewExpvarObserver(name string) Observer {
+	m := expvar.NewMap(name)
+	o := &expvarObserver{
+		started:          new(expvar.Int),
+		succeeded:        new(expvar.Int),
+		failed:           new(expvar.Int),
+		inFlight:         new(expvar.Int),
+		seconds:          new(expvar.Float),
+		decryptionsKid:   new(expvar.Map).Init(),
+		decryptionsBrand: new(expvar.Map).Init(),
+		failuresKid:      new(expvar.Map).Init(),
+		failuresStage:    new(expvar.Map).Init(),
+		lookups:          new(expvar.Map).Init(),
+		missesKid:        new(expvar.Map).Init(),
+	}
+	m.Set("decryptions_started", o.started)
+	m.Set("decryptions_succeeded", o.succeeded)
+	m.Set("decryptions_failed", o.failed)
+	m.Set("decryptions_in_flight", o.inFlight)
+	m.Set("decryption_seconds_total", o.seconds)
+	m.Set("decryptions_by_kid", o.decryptionsKid)
+	m.Set("decryptions_by_brand", o.decryptionsBrand)
+	m.Set("failures_by_kid", o.failuresKid)
+	m.Set("failures_by_stage", o.failuresStage)
+	m.Set("key_lookups_by_result", o.lookups)
+	m.Set("key_misses_by_kid", o.missesKid)
+	return o
+}
+
+type expvarObserver struct {
+	started, succeeded, failed, inFlight *expvar.Int
+	seconds                              *expvar.Float
+
+	decryptionsKid, decryptionsBrand *expvar.Map
+	failuresKid, failuresStage       *expvar.Map
+	lookups, missesKid               *expvar.Map
+
+	kids kidLabels
+}
+
+func (o *expvarObserver) DecryptStarted(DecryptStartedEvent) {
+	o.started.Add(1)
+	o.inFlight.Add(1)
+}
+
+func (o *expvarObserver) DecryptFinished(e DecryptFinishedEvent) {
+	o.inFlight.Add(-1)
+	o.seconds.Add(e.Duration.Seconds())
+	kid := o.kids.label(e.Kid)
+	o.decryptionsKid.Add(kid, 1)
+	if e.Err != nil {
+		o.failed.Add(1)
+		o.failuresKid.Add(kid, 1)
+		o.failuresStage.Add(stageLabel(e.Stage), 1)
+		return
+	}
+	o.succeeded.Add(1)
+	o.decryptionsBrand.Add(brandLabel(e.Brand), 1)
+}
+
+func (o *expvarObserver) KeyLookup(e KeyLookupEvent) {
+	if e.Found {
+		o.kids.keyFound(e.Kid)
+	}
+	result := keyLookupResult(e)
+	o.lookups.Add(result, 1)
+	if result == "miss" {
+		o.missesKid.Add(o.kids.label(e.Kid), 1)
+	}
+}
+
+var _ Observer = &expvarObserver{}
@@ -0,0 +1,95 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// countingProvider records the lookups to show a token was rejected before any key work
+type countingProvider struct {
+	KeyProvider
+	lookups int
+}
+
+func (p *countingProvider) GetKey(kid string) PrivateKey {
+	p.lookups++
+	return p.KeyProvider.GetKey(kid)
+}
+
+func TestHeaderPolicy(t *testing.T) {
+	key := getRSAKey()
+	tests := []struct {
+		name    string
+		policy  HeaderPolicy
+		mutate  func(h *jweHeader)
+		wantErr string
+	}{
+		{
+			name:   "Samsung Pay token passes the Samsung Pay policy",
+			policy: SamsungPayHeaderPolicy(),
+			mutate: func(h *jweHeader) {},
+		},
+		{
+			name:   "empty policy allows any supported header",
+			policy: HeaderPolicy{},
+			mutate: func(h *jweHeader) {
+				h.Alg = AlgRSAOAEP
+				h.Typ = "JWE"
+				h.ChannelSecurityContext = ""
+			},
+		},
+		{
+			name:    "disallowed alg is rejected",
+			policy:  SamsungPayHeaderPolicy(),
+			mutate:  func(h *jweHeader) { h.Alg = AlgRSAOAEP256 },
+			wantErr: "header 'alg' value 'RSA-OAEP-256' not allowed",
+		},
+		{
+			name:    "disallowed enc is rejected",
+			policy:  HeaderPolicy{Encryptions: []string{EncA128GCM, EncA256GCM}},
+			mutate:  func(h *jweHeader) { h.Enc = EncA192GCM },
+			wantErr: "header 'enc' value 'A192GCM' not allowed",
+		},
+		{
+			name:    "disallowed typ is rejected",
+			policy:  SamsungPayHeaderPolicy(),
+			mutate:  func(h *jweHeader) { h.Typ = "JWT" },
+			wantErr: "header 'typ' value 'JWT' not allowed",
+		},
+		{
+			name:    "missing channelSecurityContext is rejected",
+			policy:  SamsungPayHeaderPolicy(),
+			mutate:  func(h *jweHeader) { h.ChannelSecurityContext = "" },
+			wantErr: "header 'channelSecurityContext' value '' not allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &countingProvider{KeyProvider: NewMemoryKeyProvider(key)}
+			d := must(NewJWEDecryptor("100", provider, WithHeaderPolicy(tt.policy)))
+
+			header := mockHeader(&key.PublicKey)
+			tt.mutate(&header)
+			alg := contentEncryptionAlgorithms[header.Enc]
+			jwe, pt := sealJWE(header, &key.PublicKey, randomBytes(alg.keySize), randomBytes(alg.ivSize), mockCredential(mastercardTestCard, "100", "SAR"))
+
+			got, err := d.Decrypt3DSData([]byte(jwe))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Decrypt3DSData() error = %v", err)
+				}
+				if string(got) != string(pt) {
+					t.Errorf("Decrypt3DSData() = %s, want %s", got, pt)
+				}
+				return
+			}
+			if !errors.Is(err, ErrHeaderPolicy) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decrypt3DSData() error = %v, want %s", err, tt.wantErr)
+			}
+			if provider.lookups != 0 {
+				t.Errorf("key was looked up %d times for a rejected header", provider.lookups)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Key management algorithms supported for the `alg` header, per RFC 7518 section 4.
+const (
+	AlgRSA1_5     = "RSA1_5"
+	AlgRSAOAEP    = "RSA-OAEP"
+	AlgRSAOAEP256 = "RSA-OAEP-256"
+)
+
+// keyManagementAlgorithm wraps and unwraps the content encryption key (CEK).
+//
+// Unwrapping uses implicit rejection: when the encrypted key does not decrypt to a
+// well-formed CEK of `cekSize` bytes, a random CEK is returned in its place. The
+// failure then surfaces as ErrAuthenticationFailed during content decryption,
+// indistinguishable from a tampered ciphertext, so the decryptor cannot be used as
+// a padding oracle (Bleichenbacher's attack on RSA1_5, Manger's on RSA-OAEP).
+type keyManagementAlgorithm struct {
+	decrypt func(key crypto.Decrypter, encKey []byte, cekSize int) ([]byte, error)
+	encrypt func(key *rsa.PublicKey, cek []byte) ([]byte, error)
+}
+
+var keyManagementAlgorithms = map[string]keyManagementAlgorithm{
+	AlgRSA1_5: {
+		decrypt: func(key crypto.Decrypter, encKey []byte, cekSize int) ([]byte, error) {
+			// *rsa.PrivateKey returns a random CEK in constant time if the padding or length is
+			// wrong. Other Decrypters may not honor SessionKeyLen, hence the implicitReject.
+			return implicitReject(key.Decrypt(rand.Reader, encKey, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: cekSize}))(cekSize)
+		},
+		encrypt: func(key *rsa.PublicKey, cek []byte) ([]byte, error) {
+			return rsa.EncryptPKCS1v15(rand.Reader, key, cek)
+		},
+	},
+	AlgRSAOAEP: {
+		decrypt: func(key crypto.Decrypter, encKey []byte, cekSize int) ([]byte, error) {
+			return implicitReject(key.Decrypt(rand.Reader, encKey, &rsa.OAEPOptions{Hash: crypto.SHA1}))(cekSize)
+		},
+		encrypt: func(key *rsa.PublicKey, cek []byte) ([]byte, error) {
+			return rsa.EncryptOAEP(sha1.New(), rand.Reader, key, cek, nil)
+		},
+	},
+	AlgRSAOAEP256: {
+		decrypt: func(key crypto.Decrypter, encKey []byte, cekSize int) ([]byte, error) {
+			return implicitReject(key.Decrypt(rand.Reader, encKey, &rsa.OAEPOptions{Hash: crypto.SHA256}))(cekSize)
+		},
+		encrypt: func(key *rsa.PublicKey, cek []byte) ([]byte, error) {
+			return rsa.EncryptOAEP(sha256.New(), rand.Reader, key, cek, nil)
+		},
+	},
+}
+
+// implicitReject replaces a failed or wrongly sized unwrap result with a random CEK.
+// The rejected result is wiped, as it may still be key material.
+func implicitReject(cek []byte, err error) func(cekSize int) ([]byte, error) {
+	return func(cekSize int) ([]byte, error) {
+		if err != nil || len(cek) != cekSize {
+			clear(cek)
+			return randomCEK(cekSize)
+		}
+		return cek, nil
+	}
+}
+
+func randomCEK(size int) ([]byte, error) {
+	cek := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return nil, err
+	}
+	return cek, nil
+}
+
+// Content encryption algorithms supported for the `enc` header, per RFC 7518 section 5.
+const (
+	EncA128GCM      = "A128GCM"
+	EncA192GCM      = "A192GCM"
+	EncA256GCM      = "A256GCM"
+	EncA128CBCHS256 = "A128CBC-HS256"
+	EncA192CBCHS384 = "A192CBC-HS384"
+	EncA256CBCHS512 = "A256CBC-HS512"
+)
+
+// contentEncryptionAlgorithm encrypts and decrypts the payload using the CEK.
+// The sizes are in bytes and are checked before the algorithm functions are called.
+// The plaintext is appended to `dst`, which must not overlap the other arguments.
+type contentEncryptionAlgorithm struct {
+	keySize int
+	ivSize  int
+	tagSize int
+	// optionalAAD is set for the algorithms Samsung Pay uses without authenticating
+	// the protected header, i.e. with an empty AAD
+	optionalAAD bool
+	decrypt     func(dst, cek, iv, aad, ciphertext, tag []byte) ([]byte, error)
+	encrypt     func(cek, iv, aad, plaintext []byte) (ciphertext, tag []byte, err error)
+}
+
+var contentEncryptionAlgorithms = map[string]contentEncryptionAlgorithm{
+	EncA128GCM:      {keySize: 16, ivSize: 12, tagSize: 16, optionalAAD: true, decrypt: gcmDecrypt, encrypt: gcmEncrypt},
+	EncA192GCM:      {keySize: 24, ivSize: 12, tagSize: 16, optionalAAD: true, decrypt: gcmDecrypt, encrypt: gcmEncrypt},
+	EncA256GCM:      {keySize: 32, ivSize: 12, tagSize: 16, optionalAAD: true, decrypt: gcmDecrypt, encrypt: gcmEncrypt},
+	EncA128CBCHS256: cbcHMAC(32, sha256.New),
+	EncA192CBCHS384: cbcHMAC(48, sha512.New384),
+	EncA256CBCHS512: cbcHMAC(64, sha512.New),
+}
+
+// gcmDecrypt opens AES-GCM content
+func gcmDecrypt(dst, cek, iv, aad, ciphertext, tag []byte) ([]byte, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+	sealed, copied := sealedGCM(ciphertext, tag)
+	if copied {
+		defer clear(sealed)
+	}
+	plain, err := aesgcm.Open(dst, iv, sealed, aad)
+	if err != nil {
+		return nil, fmt.Errorf("opening GCM: %w", err)
+	}
+	return plain, nil
+}
+
+// sealedGCM returns ciphertext || tag, the input of cipher.AEAD.Open. The storage of
+// `ciphertext` is reused when the tag directly follows it, as parseCompact arranges;
+// otherwise they are copied to a new slice.
+func sealedGCM(ciphertext, tag []byte) (sealed []byte, copied bool) {
+	if n := len(ciphertext); len(tag) > 0 && cap(ciphertext)-n >= len(tag) && &ciphertext[:n+1][n] == &tag[0] {
+		return ciphertext[:n+len(tag)], false
+	}
+	sealed = make([]byte, 0, len(ciphertext)+len(tag))
+	return append(append(sealed, ciphertext...), tag...), true
+}
+
+// sliceForAppend extends `in` by `n` bytes, returning the whole slice and the extension
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	return head, head[len(in):]
+}
+
+func gcmEncrypt(cek, iv, aad, plaintext []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed := aesgcm.Seal(nil, iv, plaintext, aad)
+	return sealed[:len(sealed)-aesgcm.Overhead()], sealed[len(sealed)-aesgcm.Overhead():], nil
+}
+
+// cbcHMAC implements the AES_CBC_HMAC_SHA2 family of RFC 7518 section 5.2. The first
+// half of the CEK is the MAC key and the second half is the AES key. The tag is the
+// truncated HMAC over AAD || IV || ciphertext || AL, where AL is the bit length of the AAD.
+func cbcHMAC(keySize int, hash func() hash.Hash) contentEncryptionAlgorithm {
+	tagSize := keySize / 2
+	mac := func(macKey, iv, aad, ciphertext []byte) []byte {
+		h := hmac.New(hash, macKey)
+		h.Write(aad)
+		h.Write(iv)
+		h.Write(ciphertext)
+		_ = binary.Write(h, binary.BigEndian, uint64(len(aad))*8)
+		return h.Sum(nil)[:tagSize]
+	}
+	return contentEncryptionAlgorithm{
+		keySize: keySize,
+		ivSize:  aes.BlockSize,
+		tagSize: tagSize,
+		decrypt: func(dst, cek, iv, aad, ciphertext, tag []byte) ([]byte, error) {
+			macKey, encKey := cek[:keySize/2], cek[keySize/2:]
+			if !hmac.Equal(tag, mac(macKey, iv, aad, ciphertext)) {
+				return nil, errors.New("authentication tag mismatch")
+			}
+			if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+				return nil, errors.New("ciphertext is not a multiple of the block size")
+			}
+			block, err := aes.NewCipher(encKey)
+			if err != nil {
+				return nil, fmt.Errorf("creating cipher: %w", err)
+			}
+			ret, plain := sliceForAppend(dst, len(ciphertext))
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+			pad := int(plain[len(plain)-1])
+			if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+				clear(plain)
+				return nil, errors.New("invalid padding")
+			}
+			return ret[:len(ret)-pad], nil
+		},
+		encrypt: func(cek, iv, aad, plaintext []byte) ([]byte, []byte, error) {
+			macKey, encKey := cek[:keySize/2], cek[keySize/2:]
+			block, err := aes.NewCipher(encKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+			ciphertext := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+			return ciphertext, mac(macKey, iv, aad, ciphertext), nil
+		},
+	}
+}
@@ -1,106 +1,291 @@
 package samsungpaycodec
 
 import (
-	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
+	"context"
 	"crypto/rsa"
-	"encoding/base64"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"strconv"
+	"time"
 )
 
 type Decryptor interface {
 	Decrypt3DSData(payload []byte) (plain []byte, err error)
 }
 
-// A factory function to produce JWE decryptors compliant to the stated
-// version spec and using `provider` for key retrieval
-func NewJWEDecryptor(version string, provider KeyProvider) (Decryptor, error) {
-	switch version {
-	case "100":
-		return jweRSADecryptorV100{provider: provider}, nil
-	default:
-		return nil, fmt.Errorf("version '%s' not supported", version)
-	}
-}
-
-const (
-	headerIndex = iota
-	encryptionKeyIndex
-	nonceIndex
-	cipherTextIndex
-	tagIndex
-)
+// ContextDecryptor is the context-aware counterpart of Decryptor. The context is
+// carried to the key lookup, so deadlines and cancellation apply to remote key stores.
+type ContextDecryptor interface {
+	Decrypt3DSDataContext(ctx context.Context, payload []byte) (plain []byte, err error)
+}
 
-type jweRSADecryptorV100 struct {
-	provider KeyProvider
+// ContextDecryptorOf adapts `d` to ContextDecryptor. Decryptors already implementing
+// ContextDecryptor are returned as-is, otherwise Decrypt3DSData is called once `ctx` is checked.
+func ContextDecryptorOf(d Decryptor) ContextDecryptor {
+	if cd, ok := d.(ContextDecryptor); ok {
+		return cd
+	}
+	return decryptorContextAdapter{d}
 }
 
-func (d jweRSADecryptorV100) Decrypt3DSData(payload []byte) ([]byte, error) {
-	parts := bytes.Split(payload, []byte("."))
+type decryptorContextAdapter struct {
+	Decryptor
+}
 
-	// ----- Begin Extract KID ---
-	header := sliceForPart(parts[headerIndex])
-	if _, err := base64Decoder.Decode(header, parts[headerIndex]); err != nil {
-		return nil, fmt.Errorf("decoding the zeroth-part of payload: %w", err)
+func (a decryptorContextAdapter) Decrypt3DSDataContext(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	decodedHeader := make(map[string]string)
-	if err := json.Unmarshal(header, &decodedHeader); err != nil {
-		return nil, fmt.Errorf("unmarshalling header: %w", err)
+	return a.Decrypt3DSData(payload)
+}
+
+// AppendDecryptor is implemented by the decryptors able to decrypt into a buffer of the
+// caller, so that the buffer can be reused across payloads.
+type AppendDecryptor interface {
+	// DecryptTo appends the plaintext of `payload` to `dst` and returns the extended
+	// slice. To reuse the storage of `dst` for the plaintext, pass dst[:0].
+	DecryptTo(dst, payload []byte) (plain []byte, err error)
+	// DecryptToContext is DecryptTo carrying `ctx` to the key lookup.
+	DecryptToContext(ctx context.Context, dst, payload []byte) (plain []byte, err error)
+}
+
+// DecryptorOption configures the decryptors produced by NewJWEDecryptor
+type DecryptorOption func(*decryptorConfig)
+
+type decryptorConfig struct {
+	headerPolicy   HeaderPolicy
+	maxPayloadSize int
+	// expiryClock is set when expired tokens are rejected
+	expiryClock func() time.Time
+	observer    Observer
+	tracer      Tracer
+}
+
+// WithHeaderPolicy rejects tokens whose header is not allowed by `policy`.
+// The policy is enforced before the key is looked up.
+func WithHeaderPolicy(policy HeaderPolicy) DecryptorOption {
+	return func(c *decryptorConfig) {
+		c.headerPolicy = policy
 	}
+}
 
-	key := d.provider.GetKey(decodedHeader["kid"])
-	if key == nil {
-		return nil, errors.New("key not Found")
+// WithMaxPayloadSize rejects payloads larger than `n` bytes before they are parsed.
+// It defaults to DefaultMaxPayloadSize, which is also used if `n` is not positive.
+func WithMaxPayloadSize(n int) DecryptorOption {
+	if n <= 0 {
+		n = DefaultMaxPayloadSize
 	}
-	// ----- End Extract KID ---
+	return func(c *decryptorConfig) {
+		c.maxPayloadSize = n
+	}
+}
 
-	encKey := sliceForPart(parts[encryptionKeyIndex])
-	if _, err := base64Decoder.Decode(encKey, parts[encryptionKeyIndex]); err != nil {
-		return nil, fmt.Errorf("decoding first-part of payload: %w", err)
+// WithExpiryCheck rejects credentials whose token expired before `now()` with
+// ErrTokenExpired. A nil `now` uses time.Now.
+func WithExpiryCheck(now func() time.Time) DecryptorOption {
+	if now == nil {
+		now = time.Now
 	}
+	return func(c *decryptorConfig) {
+		c.expiryClock = now
+	}
+}
 
-	iv := sliceForPart(parts[nonceIndex])
-	if _, err := base64Decoder.Decode(iv, parts[nonceIndex]); err != nil {
-		return nil, fmt.Errorf("decoding second-part of payload: %w", err)
+// A factory function to produce JWE decryptors compliant to the stated
+// version spec and using `provider` for key retrieval. The versions are
+// those added with RegisterVersion, see Versions.
+func NewJWEDecryptor(version string, provider KeyProvider, opts ...DecryptorOption) (Decryptor, error) {
+	factory, ok := lookupVersion(version)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnsupportedVersion, version)
 	}
+	return factory(provider, opts...)
+}
 
-	cipherText := sliceForPart(parts[cipherTextIndex])
-	if _, err := base64Decoder.Decode(cipherText, parts[cipherTextIndex]); err != nil {
-		return nil, fmt.Errorf("decoding third-part of payload: %w", err)
+func newDecryptorConfig(opts []DecryptorOption) decryptorConfig {
+	config := decryptorConfig{maxPayloadSize: DefaultMaxPayloadSize}
+	for _, opt := range opts {
+		opt(&config)
 	}
+	return config
+}
+
+func init() {
+	RegisterVersion("100", newJWERSADecryptorV100)
+}
+
+func newJWERSADecryptorV100(provider KeyProvider, opts ...DecryptorOption) (Decryptor, error) {
+	return jweRSADecryptorV100{provider: ContextKeyProviderOf(provider), config: newDecryptorConfig(opts)}, nil
+}
+
+type jweHeader struct {
+	Alg                    string `json:"alg"`
+	Kid                    string `json:"kid"`
+	Typ                    string `json:"typ"`
+	ChannelSecurityContext string `json:"channelSecurityContext"`
+	Enc                    string `json:"enc"`
+}
+
+type jweRSADecryptorV100 struct {
+	provider ContextKeyProvider
+	config   decryptorConfig
+}
+
+func (d jweRSADecryptorV100) Decrypt3DSData(payload []byte) ([]byte, error) {
+	return d.Decrypt3DSDataContext(context.Background(), payload)
+}
 
-	tag := sliceForPart(parts[tagIndex])
-	if _, err := base64Decoder.Decode(tag, parts[tagIndex]); err != nil {
-		return nil, fmt.Errorf("decoding fourth-part of payload: %w", err)
+func (d jweRSADecryptorV100) Decrypt3DSDataContext(ctx context.Context, payload []byte) ([]byte, error) {
+	return d.DecryptToContext(ctx, nil, payload)
+}
+
+func (d jweRSADecryptorV100) DecryptTo(dst, payload []byte) ([]byte, error) {
+	return d.DecryptToContext(context.Background(), dst, payload)
+}
+
+func (d jweRSADecryptorV100) DecryptToContext(ctx context.Context, dst, payload []byte) ([]byte, error) {
+	event := DecryptFinishedEvent{Version: "100"}
+	observer, tracer := d.config.observer, d.config.tracer
+	if observer == nil && tracer == nil {
+		return d.decrypt(ctx, dst, payload, &event)
+	}
+	if observer != nil {
+		observer.DecryptStarted(DecryptStartedEvent{Version: event.Version})
 	}
+	start := time.Now()
+	ctx, span := d.config.startSpan(ctx, SpanDecrypt, spanAttrs{version: event.Version})
+	out, err := d.decrypt(ctx, dst, payload, &event)
+	var plain []byte
+	if err == nil {
+		plain = out[len(dst):]
+	}
+	event.finish(start, plain, err)
+	if tracer != nil {
+		span.SetAttributes(spanAttrs{kid: event.Kid, alg: event.Alg, enc: event.Enc}.list()...)
+		if err != nil {
+			span.SetAttributes(Attribute{AttrStage, stageLabel(event.Stage)})
+		} else {
+			span.SetAttributes(Attribute{AttrBrand, brandLabel(event.Brand)}, Attribute{AttrHeaderAuthenticated, strconv.FormatBool(event.HeaderAuthenticated)})
+		}
+	}
+	endSpan(span, err)
+	if observer != nil {
+		observer.DecryptFinished(event)
+	}
+	return out, err
+}
 
-	plainEncKey, err := rsa.DecryptPKCS1v15(nil, key.(*rsa.PrivateKey), encKey)
+// decrypt records the header values in `event` as they are parsed. Each stage runs
+// in its own span, which a failure ends.
+func (d jweRSADecryptorV100) decrypt(ctx context.Context, dst, payload []byte, event *DecryptFinishedEvent) ([]byte, error) {
+	var kid string
+	attrs := spanAttrs{version: event.Version}
+	var span Span = noopSpan{}
+	fail := func(stage Stage, err error) error {
+		de := &DecryptError{Stage: stage, Kid: kid, Err: err}
+		endSpan(span, de)
+		return de
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fail(StageParse, err)
+	}
+	_, span = d.config.startSpan(ctx, spanParse, attrs)
+	jwe, err := parseCompact(payload, d.config.maxPayloadSize)
 	if err != nil {
-		return nil, fmt.Errorf("decrypting the key: %w", err)
+		return nil, fail(StageParse, err)
+	}
+	defer jwe.release()
+	kid = jwe.header.Kid
+	event.Kid, event.Alg, event.Enc = kid, jwe.header.Alg, jwe.header.Enc
+	attrs.kid, attrs.alg, attrs.enc = kid, jwe.header.Alg, jwe.header.Enc
+	if err := d.config.headerPolicy.check(jwe.header); err != nil {
+		return nil, fail(StageHeader, err)
+	}
+	keyAlg, ok := keyManagementAlgorithms[jwe.header.Alg]
+	if !ok {
+		return nil, fail(StageHeader, fmt.Errorf("%w: key management algorithm '%s'", ErrUnsupportedAlgorithm, jwe.header.Alg))
 	}
+	contentAlg, ok := contentEncryptionAlgorithms[jwe.header.Enc]
+	if !ok {
+		return nil, fail(StageHeader, fmt.Errorf("%w: content encryption algorithm '%s'", ErrUnsupportedAlgorithm, jwe.header.Enc))
+	}
+	if len(jwe.iv) != contentAlg.ivSize {
+		return nil, fail(StageParse, fmt.Errorf("%w: invalid IV length %d for %s", ErrMalformedToken, len(jwe.iv), jwe.header.Enc))
+	}
+	if len(jwe.tag) != contentAlg.tagSize {
+		return nil, fail(StageParse, fmt.Errorf("%w: invalid authentication tag length %d for %s", ErrMalformedToken, len(jwe.tag), jwe.header.Enc))
+	}
+
+	endSpan(span, nil)
 
-	cipherBlock, err := aes.NewCipher(plainEncKey)
+	lookupCtx, span := d.config.startSpan(ctx, spanKeyLookup, attrs)
+	key, err := observeKeyLookup(lookupCtx, d.provider, d.config.observer, kid)
 	if err != nil {
-		return nil, fmt.Errorf("creating cipher: %w", err)
+		return nil, fail(StageKeyLookup, err)
 	}
-	aesgcm, err := cipher.NewGCM(cipherBlock)
+	if key == nil {
+		return nil, fail(StageKeyLookup, ErrKeyNotFound)
+	}
+	pub, ok := key.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fail(StageKeyLookup, fmt.Errorf("%w: %T is not an RSA key", ErrInvalidKey, key.Public()))
+	}
+
+	endSpan(span, nil)
+
+	_, span = d.config.startSpan(ctx, spanKeyUnwrap, attrs)
+	if len(jwe.encryptedKey) != pub.Size() {
+		return nil, fail(StageKeyUnwrap, fmt.Errorf("%w: encrypted key of %d bytes does not match the %d-byte key", ErrMalformedToken, len(jwe.encryptedKey), pub.Size()))
+	}
+	// the deadline may have passed during the key lookup; skip the RSA work if so
+	if err := ctx.Err(); err != nil {
+		return nil, fail(StageKeyUnwrap, err)
+	}
+	// a malformed encrypted key yields a random CEK rather than an error,
+	// failing authentication below like any other tampering
+	plainEncKey, err := keyAlg.decrypt(key, jwe.encryptedKey, contentAlg.keySize)
 	if err != nil {
-		return nil, fmt.Errorf("creating GCM: %w", err)
+		return nil, fail(StageKeyUnwrap, fmt.Errorf("%w: %w", ErrKeyUnwrapFailed, err))
 	}
+	defer clear(plainEncKey)
+	endSpan(span, nil)
 
-	plain, err := aesgcm.Open(nil, iv, append(cipherText, tag...), nil)
+	_, span = d.config.startSpan(ctx, spanContentDecrypt, attrs)
+	out, err := contentAlg.decrypt(dst, plainEncKey, jwe.iv, jwe.rawHeader, jwe.ciphertext, jwe.tag)
+	event.HeaderAuthenticated = err == nil
+	if err != nil && contentAlg.optionalAAD && !d.config.headerPolicy.AuthenticatedHeader {
+		out, err = contentAlg.decrypt(dst, plainEncKey, jwe.iv, nil, jwe.ciphertext, jwe.tag)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("opening GCM: %w", err)
+		return nil, fail(StageContentDecrypt, fmt.Errorf("%w: %w", ErrAuthenticationFailed, err))
 	}
-	return plain, nil
-}
-func sliceForPart(part []byte) []byte {
-	return make([]byte, base64Decoder.DecodedLen(len(part)))
+	endSpan(span, nil)
+
+	if d.config.expiryClock != nil {
+		_, span = d.config.startSpan(ctx, spanValidate, attrs)
+		if err := checkExpiry(out[len(dst):], d.config.expiryClock()); err != nil {
+			clear(out[len(dst):])
+			return nil, fail(StageValidate, err)
+		}
+		endSpan(span, nil)
+	}
+	return out, nil
 }
 
-var base64Decoder = base64.RawURLEncoding
+func checkExpiry(plain []byte, now time.Time) error {
+	pc, err := ParseCredential(plain)
+	if err != nil {
+		return err
+	}
+	exp, err := pc.Expiry()
+	if err != nil {
+		return err
+	}
+	if exp.Expired(now) {
+		return ErrTokenExpired
+	}
+	return nil
+}
 
 var _ Decryptor = jweRSADecryptorV100{}
+var _ ContextDecryptor = jweRSADecryptorV100{}
+var _ AppendDecryptor = jweRSADecryptorV100{}
@@ -1,11 +1,24 @@
 package samsungpaycodec
 
 import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func Test_JWERSADecryptorV100_Decrypt3DSData(t *testing.T) {
@@ -53,6 +66,499 @@ func Test_JWERSADecryptorV100_Decrypt3DSData(t *testing.T) {
 	}
 }
 
+func TestJWERSADecryptorV100KeyManagementAlgorithms(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	for _, alg := range []string{AlgRSA1_5, AlgRSAOAEP, AlgRSAOAEP256} {
+		t.Run(alg, func(t *testing.T) {
+			header := mockHeader(&key.PublicKey)
+			header.Alg = alg
+			jwe, pt := mockJWE(header, &key.PublicKey, mockCredential(mastercardTestCard, "100", "SAR"))
+			got, err := d.Decrypt3DSData([]byte(jwe))
+			if err != nil {
+				t.Fatalf("Decrypt3DSData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, pt) {
+				t.Errorf("Decrypt3DSData() = %s, want %s", got, pt)
+			}
+		})
+	}
+}
+
+func TestJWERSADecryptorV100RejectsUnknownAlgorithm(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	for _, alg := range []string{"", "dir", "RSA-OAEP-384", "ECDH-ES"} {
+		jwe, _ := mockJWE(mockHeader(&key.PublicKey), &key.PublicKey, mockCredential(mastercardTestCard, "100", "SAR"))
+		parts := strings.SplitN(jwe, ".", 2)
+		header := mockHeader(&key.PublicKey)
+		header.Alg = alg
+		headerbs, _ := json.Marshal(header)
+		tampered := base64Decoder.EncodeToString(headerbs) + "." + parts[1]
+
+		_, err := d.Decrypt3DSData([]byte(tampered))
+		if !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("Decrypt3DSData() with alg '%s' error = %v, want unsupported algorithm", alg, err)
+		}
+	}
+}
+
+func TestJWERSADecryptorV100ContentEncryptionAlgorithms(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	for enc, alg := range contentEncryptionAlgorithms {
+		t.Run(enc, func(t *testing.T) {
+			header := mockHeader(&key.PublicKey)
+			header.Alg = AlgRSAOAEP256
+			header.Enc = enc
+			jwe, pt := sealJWE(header, &key.PublicKey, randomBytes(alg.keySize), randomBytes(alg.ivSize), mockCredential(mastercardTestCard, "100", "SAR"))
+			got, err := d.Decrypt3DSData([]byte(jwe))
+			if err != nil {
+				t.Fatalf("Decrypt3DSData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, pt) {
+				t.Errorf("Decrypt3DSData() = %s, want %s", got, pt)
+			}
+
+			// flipping a bit of the tag must fail authentication
+			parts := strings.Split(jwe, ".")
+			tag, _ := base64Decoder.DecodeString(parts[tagIndex])
+			tag[0] ^= 1
+			parts[tagIndex] = base64Decoder.EncodeToString(tag)
+			if _, err := d.Decrypt3DSData([]byte(strings.Join(parts, "."))); err == nil {
+				t.Error("Decrypt3DSData() accepted a tampered tag")
+			}
+		})
+	}
+}
+
+func TestJWERSADecryptorV100DecryptTo(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key))).(AppendDecryptor)
+	for _, enc := range []string{EncA128GCM, EncA128CBCHS256} {
+		t.Run(enc, func(t *testing.T) {
+			alg := contentEncryptionAlgorithms[enc]
+			header := mockHeader(&key.PublicKey)
+			header.Enc = enc
+			jwe, pt := sealJWE(header, &key.PublicKey, randomBytes(alg.keySize), randomBytes(alg.ivSize), mockCredential(visaTestCard, "100", "SAR"))
+
+			dst := append(make([]byte, 0, 1024), "prefix:"...)
+			got, err := d.DecryptTo(dst, []byte(jwe))
+			if err != nil {
+				t.Fatalf("DecryptTo() error = %v", err)
+			}
+			if want := "prefix:" + string(pt); string(got) != want {
+				t.Errorf("DecryptTo() = %s, want %s", got, want)
+			}
+			if &got[0] != &dst[0] {
+				t.Error("DecryptTo() did not reuse the storage of dst")
+			}
+
+			parts := strings.Split(jwe, ".")
+			tag, _ := base64Decoder.DecodeString(parts[tagIndex])
+			tag[0] ^= 1
+			parts[tagIndex] = base64Decoder.EncodeToString(tag)
+			got, err = d.DecryptTo(got[:0], []byte(strings.Join(parts, ".")))
+			if err == nil || got != nil {
+				t.Errorf("DecryptTo() = %s, %v for a tampered tag", got, err)
+			}
+		})
+	}
+}
+
+func TestJWERSADecryptorV100AuthenticatedHeaderGCM(t *testing.T) {
+	key := getRSAKey()
+	header := mockHeader(&key.PublicKey)
+	header.Alg = AlgRSAOAEP
+	header.Enc = EncA256GCM
+	seal := func(header jweHeader, authenticated bool) string {
+		headerbs, _ := json.Marshal(header)
+		headerPart := base64Decoder.EncodeToString(headerbs)
+		cek, iv := randomBytes(32), randomBytes(12)
+		var aad []byte
+		if authenticated {
+			// RFC 7516 uses the encoded header as the AAD
+			aad = []byte(headerPart)
+		}
+		ciphertext, tag, _ := gcmEncrypt(cek, iv, aad, []byte(`{"amount":"100"}`))
+		encKey, _ := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, cek, nil)
+		return strings.Join([]string{
+			headerPart,
+			base64Decoder.EncodeToString(encKey),
+			base64Decoder.EncodeToString(iv),
+			base64Decoder.EncodeToString(ciphertext),
+			base64Decoder.EncodeToString(tag),
+		}, ".")
+	}
+	swapHeader := func(jwe string) string {
+		swapped := header
+		swapped.Typ = "JWE"
+		headerbs, _ := json.Marshal(swapped)
+		return base64Decoder.EncodeToString(headerbs) + jwe[strings.Index(jwe, "."):]
+	}
+	tests := []struct {
+		name              string
+		payload           string
+		policy            HeaderPolicy
+		wantErr           bool
+		wantAuthenticated bool
+	}{
+		{
+			name:              "RFC 7516 token",
+			payload:           seal(header, true),
+			wantAuthenticated: true,
+		},
+		{
+			name:    "Samsung Pay token",
+			payload: seal(header, false),
+		},
+		{
+			name:    "Samsung Pay token rejected by the policy",
+			payload: seal(header, false),
+			policy:  HeaderPolicy{AuthenticatedHeader: true},
+			wantErr: true,
+		},
+		{
+			name:              "RFC 7516 token passes the policy",
+			payload:           seal(header, true),
+			policy:            HeaderPolicy{AuthenticatedHeader: true},
+			wantAuthenticated: true,
+		},
+		{
+			name:    "RFC 7516 token with a swapped header",
+			payload: swapHeader(seal(header, true)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &recordingObserver{}
+			d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key), WithHeaderPolicy(tt.policy), WithObserver(o)))
+			got, err := d.Decrypt3DSData([]byte(tt.payload))
+			if tt.wantErr {
+				if !errors.Is(err, ErrAuthenticationFailed) {
+					t.Errorf("Decrypt3DSData() = %s, %v, want ErrAuthenticationFailed", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt3DSData() error = %v", err)
+			}
+			if string(got) != `{"amount":"100"}` {
+				t.Errorf("Decrypt3DSData() = %s", got)
+			}
+			if o.finished[0].HeaderAuthenticated != tt.wantAuthenticated {
+				t.Errorf("DecryptFinished() HeaderAuthenticated = %v, want %v", o.finished[0].HeaderAuthenticated, tt.wantAuthenticated)
+			}
+		})
+	}
+}
+
+func TestJWERSADecryptorV100RejectsMismatchedSizes(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	tests := []struct {
+		name    string
+		enc     string
+		cek, iv []byte
+		sealAs  string
+		wantErr string
+	}{
+		{
+			name:    "CEK shorter than enc requires",
+			enc:     EncA256GCM,
+			cek:     randomBytes(16),
+			iv:      randomBytes(12),
+			sealAs:  EncA128GCM,
+			wantErr: "authentication failed",
+		},
+		{
+			name:    "IV of the wrong size",
+			enc:     EncA128CBCHS256,
+			cek:     randomBytes(32),
+			iv:      randomBytes(12),
+			sealAs:  EncA128GCM,
+			wantErr: "invalid IV length",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := mockHeader(&key.PublicKey)
+			header.Enc = tt.sealAs
+			jwe, _ := sealJWE(header, &key.PublicKey, tt.cek[:contentEncryptionAlgorithms[tt.sealAs].keySize], tt.iv, mockCredential(mastercardTestCard, "100", "SAR"))
+			header.Enc = tt.enc
+			headerbs, _ := json.Marshal(header)
+			jwe = base64Decoder.EncodeToString(headerbs) + jwe[strings.Index(jwe, "."):]
+			_, err := d.Decrypt3DSData([]byte(jwe))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decrypt3DSData() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithMaxPayloadSize(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+	tests := []struct {
+		name    string
+		n       int
+		wantErr bool
+	}{
+		{name: "zero falls back to the default", n: 0},
+		{name: "negative falls back to the default", n: -1},
+		{name: "payload within the limit", n: len(jwe)},
+		{name: "payload over the limit", n: len(jwe) - 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key), WithMaxPayloadSize(tt.n)))
+			_, err := d.Decrypt3DSData([]byte(jwe))
+			if tt.wantErr != errors.Is(err, ErrMalformedToken) || !tt.wantErr && err != nil {
+				t.Errorf("Decrypt3DSData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// remoteProvider is a context-only provider that blocks until its context is done,
+// simulating an unresponsive remote key store
+type remoteProvider struct {
+	lookups chan string
+}
+
+func (p remoteProvider) GetKeyContext(ctx context.Context, kid string) (PrivateKey, error) {
+	p.lookups <- kid
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestJWERSADecryptorV100Context(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+
+	t.Run("deadline reaches the key provider", func(t *testing.T) {
+		provider := remoteProvider{lookups: make(chan string, 1)}
+		d := must(NewJWEDecryptor("100", KeyProviderOf(provider)))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := d.(ContextDecryptor).Decrypt3DSDataContext(ctx, []byte(jwe))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Decrypt3DSDataContext() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if kid := <-provider.lookups; kid != Kid(key) {
+			t.Errorf("GetKeyContext() kid = %s, want %s", kid, Kid(key))
+		}
+	})
+	t.Run("canceled context is not decrypted", func(t *testing.T) {
+		d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := DecryptCredentialContext(ctx, d, []byte(jwe)); !errors.Is(err, context.Canceled) {
+			t.Errorf("DecryptCredentialContext() error = %v, want %v", err, context.Canceled)
+		}
+	})
+	t.Run("context-unaware decryptors are adapted", func(t *testing.T) {
+		d := ContextDecryptorOf(struct{ Decryptor }{must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))})
+		if _, err := d.Decrypt3DSDataContext(context.Background(), []byte(jwe)); err != nil {
+			t.Errorf("Decrypt3DSDataContext() error = %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := d.Decrypt3DSDataContext(ctx, []byte(jwe)); !errors.Is(err, context.Canceled) {
+			t.Errorf("Decrypt3DSDataContext() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestJWERSADecryptorV100KeyUnwrapFailuresAreIndistinguishable(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	for _, alg := range []string{AlgRSA1_5, AlgRSAOAEP, AlgRSAOAEP256} {
+		t.Run(alg, func(t *testing.T) {
+			header := mockHeader(&key.PublicKey)
+			header.Alg = alg
+			jwe, _ := mockJWE(header, &key.PublicKey, mockCredential(mastercardTestCard, "100", "SAR"))
+			parts := strings.Split(jwe, ".")
+
+			// a random ciphertext decrypts to a badly padded block
+			badPadding := append([]string{}, parts...)
+			badPadding[encryptionKeyIndex] = base64Decoder.EncodeToString(new(big.Int).Rsh(key.N, 8).FillBytes(make([]byte, key.Size())))
+			// a well-formed CEK of the wrong size
+			shortKey, _ := keyManagementAlgorithms[alg].encrypt(&key.PublicKey, randomBytes(8))
+			wrongSize := append([]string{}, parts...)
+			wrongSize[encryptionKeyIndex] = base64Decoder.EncodeToString(shortKey)
+			// the right CEK with a tampered tag
+			badTag := append([]string{}, parts...)
+			tag, _ := base64Decoder.DecodeString(parts[tagIndex])
+			tag[0] ^= 1
+			badTag[tagIndex] = base64Decoder.EncodeToString(tag)
+
+			_, tagErr := d.Decrypt3DSData([]byte(strings.Join(badTag, ".")))
+			for name, p := range map[string][]string{"bad padding": badPadding, "wrong CEK size": wrongSize} {
+				_, err := d.Decrypt3DSData([]byte(strings.Join(p, ".")))
+				if err == nil || err.Error() != tagErr.Error() {
+					t.Errorf("%s error = %v, want %v", name, err, tagErr)
+				}
+				var got, want *DecryptError
+				if !errors.As(err, &got) || !errors.As(tagErr, &want) || got.Stage != want.Stage || !errors.Is(err, ErrAuthenticationFailed) {
+					t.Errorf("%s error = %#v, want %#v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// opaqueKey hides the key material behind crypto.Decrypter as an HSM would,
+// recording the options it was asked to decrypt with
+type opaqueKey struct {
+	key  *rsa.PrivateKey
+	opts []crypto.DecrypterOpts
+}
+
+func (k *opaqueKey) Public() crypto.PublicKey {
+	return k.key.Public()
+}
+
+// Equal compares the public halves, as the private one is out of reach
+func (k *opaqueKey) Equal(x crypto.PrivateKey) bool {
+	other, ok := x.(interface{ Public() crypto.PublicKey })
+	return ok && k.key.PublicKey.Equal(other.Public())
+}
+
+func (k *opaqueKey) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	k.opts = append(k.opts, opts)
+	switch opts := opts.(type) {
+	case *rsa.OAEPOptions:
+		return k.key.Decrypt(rand, msg, opts)
+	default:
+		// ignores SessionKeyLen like some PKCS#11 implementations
+		return rsa.DecryptPKCS1v15(rand, k.key, msg)
+	}
+}
+
+// ed25519Key is a crypto.Decrypter whose public key is not RSA
+type ed25519Key struct {
+	ed25519.PrivateKey
+}
+
+func (ed25519Key) Decrypt(io.Reader, []byte, crypto.DecrypterOpts) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestJWERSADecryptorV100CryptoDecrypter(t *testing.T) {
+	key := getRSAKey()
+	for _, alg := range []string{AlgRSA1_5, AlgRSAOAEP, AlgRSAOAEP256} {
+		t.Run(alg, func(t *testing.T) {
+			hsm := &opaqueKey{key: key}
+			d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(hsm)))
+			header := mockHeader(&key.PublicKey)
+			header.Alg = alg
+			jwe, pt := mockJWE(header, &key.PublicKey, mockCredential(mastercardTestCard, "100", "SAR"))
+			got, err := d.Decrypt3DSData([]byte(jwe))
+			if err != nil {
+				t.Fatalf("Decrypt3DSData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, pt) {
+				t.Errorf("Decrypt3DSData() = %s, want %s", got, pt)
+			}
+			if len(hsm.opts) != 1 {
+				t.Fatalf("Decrypt() called %d times, want 1", len(hsm.opts))
+			}
+
+			// padding failures of Decrypters not honoring SessionKeyLen are still implicitly rejected
+			parts := strings.Split(jwe, ".")
+			parts[encryptionKeyIndex] = base64Decoder.EncodeToString(new(big.Int).Rsh(key.N, 8).FillBytes(make([]byte, key.Size())))
+			if _, err := d.Decrypt3DSData([]byte(strings.Join(parts, "."))); !errors.Is(err, ErrAuthenticationFailed) {
+				t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrAuthenticationFailed)
+			}
+		})
+	}
+
+	t.Run("non-RSA keys are rejected", func(t *testing.T) {
+		_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+		nonRSA := ed25519Key{edKey}
+		d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(nonRSA)))
+		header := mockHeader(&key.PublicKey)
+		header.Kid = Kid(nonRSA)
+		jwe, _ := mockJWE(header, &key.PublicKey, mockCredential(mastercardTestCard, "100", "SAR"))
+		if _, err := d.Decrypt3DSData([]byte(jwe)); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrInvalidKey)
+		}
+	})
+}
+
+// benchmarkKeys are generated once, as the 4096-bit key takes seconds
+var benchmarkKeys = sync.OnceValue(func() map[int]*rsa.PrivateKey {
+	keys := make(map[int]*rsa.PrivateKey)
+	for _, bits := range []int{2048, 3072, 4096} {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			panic(err)
+		}
+		keys[bits] = key
+	}
+	return keys
+})
+
+func benchmarkDecryptor(b *testing.B, run func(b *testing.B, d Decryptor, payload []byte)) {
+	for _, bits := range []int{2048, 3072, 4096} {
+		b.Run(fmt.Sprintf("RSA-%d", bits), func(b *testing.B) {
+			key := benchmarkKeys()[bits]
+			d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+			jwe, _ := GetMockMastercard(key, "106000", "USD")
+			b.ReportAllocs()
+			b.SetBytes(int64(len(jwe)))
+			b.ResetTimer()
+			run(b, d, []byte(jwe))
+		})
+	}
+}
+
+func BenchmarkDecrypt3DSData(b *testing.B) {
+	benchmarkDecryptor(b, func(b *testing.B, d Decryptor, payload []byte) {
+		for i := 0; i < b.N; i++ {
+			if _, err := d.Decrypt3DSData(payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecryptTo(b *testing.B) {
+	benchmarkDecryptor(b, func(b *testing.B, d Decryptor, payload []byte) {
+		ad := d.(AppendDecryptor)
+		dst := make([]byte, 0, 1024)
+		for i := 0; i < b.N; i++ {
+			var err error
+			if dst, err = ad.DecryptTo(dst[:0], payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecrypt3DSDataParallel(b *testing.B) {
+	benchmarkDecryptor(b, func(b *testing.B, d Decryptor, payload []byte) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := d.Decrypt3DSData(payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func must(d Decryptor, err error) Decryptor {
 	if err != nil {
 		panic(err)
@@ -1,7 +1,9 @@
 package samsungpaycodec
 
 import (
+	"context"
 	"crypto"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
@@ -9,12 +11,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
-// Per: https://pkg.go.dev/crypto#PrivateKey
+// PrivateKey is any key able to decrypt, so keys held in an HSM, a PKCS#11 token or
+// a remote service can be used without the key material entering the process.
+// Per: https://pkg.go.dev/crypto#PrivateKey and https://pkg.go.dev/crypto#Decrypter
 type PrivateKey interface {
-	Public() crypto.PublicKey
+	crypto.Decrypter
 	Equal(x crypto.PrivateKey) bool
 }
 
@@ -38,20 +43,105 @@ type KeyProvider interface {
 	GetKey(kid string) PrivateKey
 }
 
+// ContextKeyProvider is the context-aware counterpart of KeyProvider, for providers
+// backed by storage that should honor deadlines and cancellation, e.g. a remote
+// key store. It returns ErrKeyNotFound when no key matches `kid`.
+type ContextKeyProvider interface {
+	GetKeyContext(ctx context.Context, kid string) (PrivateKey, error)
+}
+
+// ContextKeyProviderOf adapts `p` to ContextKeyProvider. Providers already implementing
+// ContextKeyProvider are returned as-is, otherwise GetKey is called once `ctx` is checked.
+func ContextKeyProviderOf(p KeyProvider) ContextKeyProvider {
+	if cp, ok := p.(ContextKeyProvider); ok {
+		return cp
+	}
+	return keyProviderContextAdapter{p}
+}
+
+// KeyProviderOf adapts `p` to KeyProvider so it can be given to NewJWEDecryptor.
+// The context-aware decryption path still reaches GetKeyContext of `p`.
+func KeyProviderOf(p ContextKeyProvider) KeyProvider {
+	if kp, ok := p.(KeyProvider); ok {
+		return kp
+	}
+	return contextKeyProviderAdapter{p}
+}
+
+type keyProviderContextAdapter struct {
+	KeyProvider
+}
+
+func (a keyProviderContextAdapter) GetKeyContext(ctx context.Context, kid string) (PrivateKey, error) {
+	return getKeyContext(ctx, a.KeyProvider, kid)
+}
+
+type contextKeyProviderAdapter struct {
+	ContextKeyProvider
+}
+
+// GetKey calls GetKeyContext with a background context, returning nil on any error
+func (a contextKeyProviderAdapter) GetKey(kid string) PrivateKey {
+	key, err := a.GetKeyContext(context.Background(), kid)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// getKeyContext implements GetKeyContext on top of GetKey for the providers
+// whose lookups do not block. It is generic so the provider is not boxed on each call.
+func getKeyContext[P KeyProvider](ctx context.Context, p P, kid string) (PrivateKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := p.GetKey(kid)
+	if key == nil {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
 // KeyAdder is a helper interface to signal the provider's
 // ability to add keys.
 type KeyAdder interface {
 	AddKey(PrivateKey) error
 }
 
+// prepareKey validates RSA keys and precomputes their CRT values, so that the cost
+// is paid once at load rather than on the first decryption. Other keys, e.g. those
+// held in an HSM, are taken as-is.
+func prepareKey(key PrivateKey) error {
+	if key == nil {
+		return fmt.Errorf("%w: nil key", ErrInvalidKey)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil
+	}
+	if err := rsaKey.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	rsaKey.Precompute()
+	return nil
+}
+
+// keyFilename is the name of the file AddKey stores the key under. The base64 of
+// the kid is converted to base64url, as it may contain '/'.
+func keyFilename(kid string) string {
+	return strings.NewReplacer("/", "_", "+", "-").Replace(kid) + ".pem"
+}
+
 type filesystemKeyProvider struct {
 	root string
 
-	kidFilename map[string]string
-	kidMu       *sync.RWMutex
+	keys  map[string]PrivateKey
+	kidMu *sync.RWMutex
 }
 
-// Expects a directory path containing private keys formatted as PKCS8 PEM
+// Expects a directory path containing private keys formatted as PKCS8 PEM. The keys
+// are parsed and validated once, a file with an invalid key failing the provider.
+// PEM blocks other than PRIVATE KEY, such as certificates, are skipped.
 func NewFilesystemKeyProvider(root string) (KeyProvider, error) {
 	rootStat, err := os.Stat(root)
 	if err != nil {
@@ -64,68 +154,76 @@ func NewFilesystemKeyProvider(root string) (KeyProvider, error) {
 	if err != nil {
 		return nil, err
 	}
-	kidFilename := make(map[string]string)
+	keys := make(map[string]PrivateKey)
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 		bs, err := os.ReadFile(filepath.Join(root, entry.Name()))
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		for block, rest := pem.Decode(bs); block != nil || len(rest) > 0; block, rest = pem.Decode(rest) {
+		for block, rest := pem.Decode(bs); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "PRIVATE KEY" {
+				continue
+			}
 			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("%w: parsing %s: %w", ErrInvalidKey, entry.Name(), err)
+			}
+			pk, ok := key.(PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("%w: %T in %s cannot decrypt", ErrInvalidKey, key, entry.Name())
+			}
+			if err := prepareKey(pk); err != nil {
+				return nil, fmt.Errorf("%w in %s", err, entry.Name())
 			}
-			kidFilename[Kid(key.(PrivateKey))] = filepath.Join(root, entry.Name())
+			keys[Kid(pk)] = pk
 		}
 	}
-	return &filesystemKeyProvider{root: root, kidFilename: kidFilename, kidMu: &sync.RWMutex{}}, nil
+	return &filesystemKeyProvider{root: root, keys: keys, kidMu: &sync.RWMutex{}}, nil
 }
 
-// GetKey returns the key stored in the file system. The keys are already indexed
-// during NewFilesystemKeyProvider call. This method only hits the filesystem to open
-// and read the subject file. Returns nil if none found.
+// GetKey returns the key stored in the file system. The keys are parsed during
+// the NewFilesystemKeyProvider call, so the file system is not accessed.
+// Returns nil if none found.
 func (p filesystemKeyProvider) GetKey(kid string) PrivateKey {
 	p.kidMu.RLock()
 	defer p.kidMu.RUnlock()
-	if fname, ok := p.kidFilename[kid]; ok {
-		bs, err := os.ReadFile(fname)
-		if err != nil {
-			return nil
-		}
-		for block, rest := pem.Decode(bs); block != nil || len(rest) > 0; block, rest = pem.Decode(rest) {
-			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-			if err != nil {
-				panic(err)
-			}
-			if key != nil && Kid(key.(PrivateKey)) == kid {
-				return key.(PrivateKey)
-			}
-		}
-	}
-	return nil
+	return p.keys[kid]
+}
+
+// GetKeyContext is GetKey returning ErrKeyNotFound if the key is not found.
+func (p filesystemKeyProvider) GetKeyContext(ctx context.Context, kid string) (PrivateKey, error) {
+	return getKeyContext(ctx, p, kid)
 }
 
+// AddKey validates the key and writes it to a new file in the root directory. It
+// fails if the file of the key already exists.
 func (p *filesystemKeyProvider) AddKey(key PrivateKey) (err error) {
+	if err := prepareKey(key); err != nil {
+		return err
+	}
 	p.kidMu.Lock()
 	defer p.kidMu.Unlock()
 
 	kid := Kid(key)
-	keyPath := filepath.Join(p.root, kid)
+	keyPath := filepath.Join(p.root, keyFilename(kid))
 	bs, err := x509.MarshalPKCS8PrivateKey(key)
 	if err != nil {
 		return err
 	}
-	f, err := os.Open(keyPath)
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		if e := f.Close(); e != nil {
+		if e := f.Close(); e != nil && err == nil {
 			err = e
 		}
+		if err != nil {
+			os.Remove(keyPath)
+		}
 	}()
 	if err := pem.Encode(f, &pem.Block{
 		Type:  "PRIVATE KEY",
@@ -133,8 +231,8 @@ func (p *filesystemKeyProvider) AddKey(key PrivateKey) (err error) {
 	}); err != nil {
 		return err
 	}
-	p.kidFilename[kid] = keyPath
-	return err
+	p.keys[kid] = key
+	return nil
 }
 
 type memoryProvider struct {
@@ -142,15 +240,31 @@ type memoryProvider struct {
 	mu   *sync.RWMutex
 }
 
-// The static key provider is an in-memory key provider
+// The static key provider is an in-memory key provider. The CRT values of the valid
+// RSA keys are precomputed; invalid keys are taken as-is and fail on use. See
+// NewValidatedMemoryKeyProvider to reject them up front.
 func NewMemoryKeyProvider(keys ...PrivateKey) KeyProvider {
 	ks := make(map[string]PrivateKey)
 	for _, k := range keys {
+		_ = prepareKey(k)
 		ks[Kid(k)] = k
 	}
 	return &memoryProvider{ks, &sync.RWMutex{}}
 }
 
+// NewValidatedMemoryKeyProvider is NewMemoryKeyProvider returning an ErrInvalidKey
+// if any RSA key is invalid, or if a key is nil.
+func NewValidatedMemoryKeyProvider(keys ...PrivateKey) (KeyProvider, error) {
+	ks := make(map[string]PrivateKey)
+	for i, k := range keys {
+		if err := prepareKey(k); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		ks[Kid(k)] = k
+	}
+	return &memoryProvider{ks, &sync.RWMutex{}}, nil
+}
+
 // GetKey returns the key from the internal memory storage. It
 // returns nil if none is found for the subject 'kid'.
 func (sp memoryProvider) GetKey(kid string) PrivateKey {
@@ -159,7 +273,16 @@ func (sp memoryProvider) GetKey(kid string) PrivateKey {
 	return sp.keys[kid]
 }
 
+// GetKeyContext is GetKey returning ErrKeyNotFound if the key is not found.
+func (sp memoryProvider) GetKeyContext(ctx context.Context, kid string) (PrivateKey, error) {
+	return getKeyContext(ctx, sp, kid)
+}
+
+// AddKey validates the key and adds it to the provider.
 func (p *memoryProvider) AddKey(key PrivateKey) (err error) {
+	if err := prepareKey(key); err != nil {
+		return err
+	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.keys[Kid(key)] = key
@@ -167,6 +290,8 @@ func (p *memoryProvider) AddKey(key PrivateKey) (err error) {
 }
 
 var _ KeyProvider = filesystemKeyProvider{}
+var _ ContextKeyProvider = filesystemKeyProvider{}
 var _ KeyAdder = &filesystemKeyProvider{}
 var _ KeyProvider = memoryProvider{}
+var _ ContextKeyProvider = memoryProvider{}
 var _ KeyAdder = &memoryProvider{}
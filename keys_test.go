@@ -1,10 +1,15 @@
 package samsungpaycodec
 
 import (
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -89,6 +94,75 @@ func TestFilesystemKeyProviderGetKey(t *testing.T) {
 	}
 }
 
+func TestGetKeyContext(t *testing.T) {
+	key := getKey()
+	tests := []struct {
+		name     string
+		p        ContextKeyProvider
+		canceled bool
+		kid      string
+		wantErr  error
+	}{
+		{
+			name: "memory provider finds the key",
+			p:    NewMemoryKeyProvider(key).(ContextKeyProvider),
+			kid:  Kid(key),
+		},
+		{
+			name:    "memory provider reports missing keys",
+			p:       NewMemoryKeyProvider(key).(ContextKeyProvider),
+			kid:     "unknown",
+			wantErr: ErrKeyNotFound,
+		},
+		{
+			name: "filesystem provider finds the key",
+			p:    mustProvider(NewFilesystemKeyProvider("testdata/fs/single-key")).(ContextKeyProvider),
+			kid:  Kid(key),
+		},
+		{
+			name:     "canceled context is honored",
+			p:        mustProvider(NewFilesystemKeyProvider("testdata/fs/single-key")).(ContextKeyProvider),
+			canceled: true,
+			kid:      Kid(key),
+			wantErr:  context.Canceled,
+		},
+		{
+			name:    "plain providers are adapted",
+			p:       ContextKeyProviderOf(struct{ KeyProvider }{NewMemoryKeyProvider(key)}),
+			kid:     "unknown",
+			wantErr: ErrKeyNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+			got, err := tt.p.GetKeyContext(ctx, tt.kid)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetKeyContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !key.Equal(got) {
+				t.Errorf("GetKeyContext() = %v, want %v", got, key)
+			}
+		})
+	}
+}
+
+func TestKeyProviderOf(t *testing.T) {
+	key := getKey()
+	cp := ContextKeyProviderOf(struct{ KeyProvider }{NewMemoryKeyProvider(key)})
+	p := KeyProviderOf(struct{ ContextKeyProvider }{cp})
+	if got := p.GetKey(Kid(key)); !key.Equal(got) {
+		t.Errorf("GetKey() = %v, want %v", got, key)
+	}
+	if got := p.GetKey("unknown"); got != nil {
+		t.Errorf("GetKey() = %v, want nil", got)
+	}
+}
+
 func TestMockMastercardCard(t *testing.T) {
 	nonceGetter = func() []byte {
 		v, _ := hex.DecodeString("db1fb1daf085ea3231eaae0a")
@@ -166,3 +240,143 @@ func TestMockAmexCard(t *testing.T) {
 		t.Errorf("Decrypt3DSData() != GetMockAmex(): %s != %s", plain, pt)
 	}
 }
+
+// invalidKey is getKey with a private exponent that does not match its public key
+func invalidKey() *rsa.PrivateKey {
+	key := *getKey().(*rsa.PrivateKey)
+	key.D = new(big.Int).Add(key.D, big.NewInt(2))
+	key.Precomputed = rsa.PrecomputedValues{}
+	return &key
+}
+
+func TestNewFilesystemKeyProviderInvalidFiles(t *testing.T) {
+	valid, _ := os.ReadFile("testdata/fs/single-key/key.pem")
+	invalid, _ := x509.MarshalPKCS8PrivateKey(invalidKey())
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+		wantKey bool
+	}{
+		{
+			name:    "key after a certificate block",
+			content: append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not parsed")}), valid...),
+			wantKey: true,
+		},
+		{
+			name:    "file without PEM is skipped",
+			content: []byte("# keys for the checkout service\n"),
+		},
+		{
+			name:    "key followed by garbage",
+			content: append(append([]byte{}, valid...), "trailing"...),
+			wantKey: true,
+		},
+		{
+			name:    "undecodable key",
+			content: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}),
+			wantErr: ErrInvalidKey,
+		},
+		{
+			name:    "inconsistent RSA key",
+			content: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: invalid}),
+			wantErr: ErrInvalidKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, "keys.pem"), tt.content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			p, err := NewFilesystemKeyProvider(root)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewFilesystemKeyProvider() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := p.GetKey(Kid(getKey())); (got != nil) != tt.wantKey {
+				t.Errorf("GetKey() = %v, want key %v", got, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestFilesystemKeyProviderCachesKeys(t *testing.T) {
+	root := t.TempDir()
+	valid, _ := os.ReadFile("testdata/fs/single-key/key.pem")
+	if err := os.WriteFile(filepath.Join(root, "key.pem"), valid, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := mustProvider(NewFilesystemKeyProvider(root))
+	if err := os.Remove(filepath.Join(root, "key.pem")); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := p.GetKey(Kid(getKey())).(*rsa.PrivateKey)
+	if !ok {
+		t.Fatal("GetKey() read the file system after the provider was created")
+	}
+	if got.Precomputed.Dp == nil {
+		t.Error("GetKey() returned a key without the CRT values precomputed")
+	}
+}
+
+func TestAddKey(t *testing.T) {
+	key := getKey()
+	root := t.TempDir()
+	providers := map[string]KeyProvider{
+		"filesystem": mustProvider(NewFilesystemKeyProvider(root)),
+		"memory":     NewMemoryKeyProvider(),
+	}
+	for name, p := range providers {
+		t.Run(name, func(t *testing.T) {
+			adder := p.(KeyAdder)
+			if err := adder.AddKey(invalidKey()); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("AddKey() error = %v for an invalid key, want %v", err, ErrInvalidKey)
+			}
+			if err := adder.AddKey(key); err != nil {
+				t.Fatalf("AddKey() error = %v", err)
+			}
+			if got := p.GetKey(Kid(key)); !key.Equal(got) {
+				t.Errorf("GetKey() = %v after AddKey()", got)
+			}
+		})
+	}
+
+	// the added key is stored for the next provider of the directory, and never overwritten
+	reloaded := mustProvider(NewFilesystemKeyProvider(root))
+	if got := reloaded.GetKey(Kid(key)); !key.Equal(got) {
+		t.Errorf("GetKey() = %v after reloading the directory", got)
+	}
+	if err := reloaded.(KeyAdder).AddKey(key); !errors.Is(err, os.ErrExist) {
+		t.Errorf("AddKey() error = %v for an existing key, want %v", err, os.ErrExist)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Errorf("AddKey() left %d files", len(entries))
+	}
+}
+
+func TestNewValidatedMemoryKeyProvider(t *testing.T) {
+	key := getKey()
+	p, err := NewValidatedMemoryKeyProvider(key)
+	if err != nil || !key.Equal(p.GetKey(Kid(key))) {
+		t.Fatalf("NewValidatedMemoryKeyProvider() = %v, %v", p, err)
+	}
+	for name, keys := range map[string][]PrivateKey{
+		"invalid key": {key, invalidKey()},
+		"nil key":     {nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewValidatedMemoryKeyProvider(keys...); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("NewValidatedMemoryKeyProvider() error = %v, want %v", err, ErrInvalidKey)
+			}
+		})
+	}
+	// the lenient constructor leaves the invalid key to AddKey and the decryption
+	lenient := NewMemoryKeyProvider(invalidKey())
+	if err := lenient.(KeyAdder).AddKey(invalidKey()); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("AddKey() error = %v, want %v", err, ErrInvalidKey)
+	}
+}
@@ -1,37 +1,19 @@
 package samsungpaycodec
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 )
 
-type paymentCredential struct {
-	Amount             string `json:"amount"`
-	CurrencyCode       string `json:"currency_code"`
-	Utc                string `json:"utc"`
-	EciIndicator       string `json:"eci_indicator"`
-	TokenPAN           string `json:"tokenPAN"`
-	TokenPanExpiration string `json:"tokenPanExpiration"`
-	Cryptogram         string `json:"cryptogram"`
-}
-
-type jweHeader struct {
-	Alg                    string `json:"alg"`
-	Kid                    string `json:"kid"`
-	Typ                    string `json:"typ"`
-	ChannelSecurityContext string `json:"channelSecurityContext"`
-	Enc                    string `json:"enc"`
-}
-
 type mpgsSPayCard struct {
 	dpan        string
+	brand       Brand
 	expiryMonth string
 	expiryYear  string
 	cryptogram  string
@@ -39,24 +21,26 @@ type mpgsSPayCard struct {
 
 const (
 	testCryptogram = "AAAAAAAALJI6DbfqRzUcwAC6gAAGhgEDoLABAAhAgAABAAAAMlkUxA=="
-	tagLength      = 16
 )
 
 var (
 	mastercardTestCard mpgsSPayCard = mpgsSPayCard{
 		dpan:        "5123456789012346",
+		brand:       BrandMastercard,
 		expiryMonth: "01",
 		expiryYear:  "39",
 		cryptogram:  testCryptogram,
 	}
 	visaTestCard = mpgsSPayCard{
-		dpan:        "340353278080900",
+		dpan:        "4440000009900010",
+		brand:       BrandVisa,
 		expiryMonth: "01",
 		expiryYear:  "39",
 		cryptogram:  testCryptogram,
 	}
 	amexTestCard = mpgsSPayCard{
-		dpan:        "4440000009900010",
+		dpan:        "340353278080900",
+		brand:       BrandAmex,
 		expiryMonth: "01",
 		expiryYear:  "39",
 		cryptogram:  testCryptogram,
@@ -78,50 +62,73 @@ var keyGetter = func() []byte {
 	return encryptionKey
 }
 
-// Produces a JWE and plaintext of a Mastercard test DPAN. Uses the test card listed on MPGS documentation:
-// https://ap-gateway.mastercard.com/api/documentation/integrationGuidelines/supportedFeatures/pickPaymentMethod/devicePayments/SamsungPay.html?locale=en_US
-func GetMockMastercard(key *rsa.PrivateKey, amount, currency string) (jwe string, plaintext []byte) {
-	header := jweHeader{
-		Alg:                    "RSA1_5",
-		Kid:                    Kid(key),
+// mockHeader is the header Samsung Pay sets on the JWEs it produces
+func mockHeader(key *rsa.PublicKey) jweHeader {
+	return jweHeader{
+		Alg:                    AlgRSA1_5,
+		Kid:                    KidFromPublic(key),
 		Typ:                    "JOSE",
 		ChannelSecurityContext: "RSA_PKI",
 		Enc:                    "A128GCM",
 	}
-	headerbs, _ := json.Marshal(header)
+}
 
-	pc := paymentCredential{
+// mockCredential builds the credential of the test card. Decimal amounts are converted
+// to the minor units of the currency. It panics if either is invalid, or if the DPAN
+// of the test card is not a valid PAN of its brand.
+func mockCredential(card mpgsSPayCard, amount, currency string) PaymentCredential {
+	if err := ValidatePAN(card.dpan); err != nil {
+		panic(err)
+	}
+	if brand := DetectBrand(card.dpan); brand != card.brand {
+		panic(fmt.Sprintf("test card %s is %s, labelled %s", card.dpan, brand, card.brand))
+	}
+	if strings.Contains(amount, ".") {
+		m, err := ParseMoney(amount, currency)
+		if err != nil {
+			panic(err)
+		}
+		amount = strconv.FormatInt(m.MinorUnits, 10)
+	}
+	return PaymentCredential{
 		Amount:             amount,
 		CurrencyCode:       currency,
 		Utc:                fmt.Sprintf("%d", time.Now().UnixMilli()),
 		EciIndicator:       "02",
-		TokenPAN:           mastercardTestCard.dpan,
-		TokenPanExpiration: mastercardTestCard.expiryMonth + mastercardTestCard.expiryYear,
-		Cryptogram:         testCryptogram,
+		TokenPAN:           card.dpan,
+		TokenPanExpiration: card.expiryMonth + card.expiryYear,
+		Cryptogram:         card.cryptogram,
 	}
-	plaintext, _ = json.Marshal(pc)
+}
+
+// mockJWE encrypts the credential to `key` with the CEK and nonce from keyGetter and nonceGetter.
+func mockJWE(header jweHeader, key *rsa.PublicKey, pc PaymentCredential) (jwe string, plaintext []byte) {
+	return sealJWE(header, key, keyGetter(), nonceGetter(), pc)
+}
 
-	encryptionKey := keyGetter()
-	nonce := nonceGetter()
+// sealJWE encrypts the credential with `cek` using the algorithms named in the header.
+func sealJWE(header jweHeader, key *rsa.PublicKey, cek, iv []byte, pc PaymentCredential) (jwe string, plaintext []byte) {
+	headerbs, _ := json.Marshal(header)
+	plaintext, _ = json.Marshal(credentialWire(pc))
 
-	block, err := aes.NewCipher(encryptionKey)
+	headerPart := base64Decoder.EncodeToString(headerbs)
+	aad := []byte(headerPart)
+	if strings.HasSuffix(header.Enc, "GCM") {
+		// Samsung Pay leaves the header unauthenticated
+		aad = nil
+	}
+	ciphertext, tag, err := contentEncryptionAlgorithms[header.Enc].encrypt(cek, iv, aad, plaintext)
 	if err != nil {
 		panic(err)
 	}
-	aesgcm, err := cipher.NewGCM(block)
+
+	encryptedKey, err := keyManagementAlgorithms[header.Alg].encrypt(key, cek)
 	if err != nil {
 		panic(err)
 	}
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
-
-	tag := ciphertext[len(ciphertext)-tagLength:]
-	ciphertext = ciphertext[:len(ciphertext)-tagLength]
 
-	encryptedKey, _ := rsa.EncryptPKCS1v15(rand.Reader, key.Public().(*rsa.PublicKey), encryptionKey)
-
-	headerPart := base64Decoder.EncodeToString(headerbs)
 	keyPart := base64Decoder.EncodeToString(encryptedKey)
-	noncePart := base64Decoder.EncodeToString(nonce)
+	noncePart := base64Decoder.EncodeToString(iv)
 	payloadPart := base64Decoder.EncodeToString(ciphertext)
 	tagPart := base64Decoder.EncodeToString(tag)
 
@@ -134,114 +141,23 @@ func GetMockMastercard(key *rsa.PrivateKey, amount, currency string) (jwe string
 	}, "."), plaintext
 }
 
+// Produces a JWE and plaintext of a Mastercard test DPAN. Uses the test card listed on MPGS documentation:
+// https://ap-gateway.mastercard.com/api/documentation/integrationGuidelines/supportedFeatures/pickPaymentMethod/devicePayments/SamsungPay.html?locale=en_US
+// The amount is in minor units, or in major units if it has a decimal point, e.g. "1.5" KWD becomes "1500".
+func GetMockMastercard(key *rsa.PrivateKey, amount, currency string) (jwe string, plaintext []byte) {
+	return GetMockMastercardWithPublicKey(&key.PublicKey, amount, currency)
+}
+
 // Produces a JWE and plaintext of a Visa test DPAN. Uses the test card listed on MPGS documentation:
 // https://ap-gateway.mastercard.com/api/documentation/integrationGuidelines/supportedFeatures/pickPaymentMethod/devicePayments/SamsungPay.html?locale=en_US
+// The amount is in minor units, or in major units if it has a decimal point, e.g. "1.5" KWD becomes "1500".
 func GetMockVisa(key *rsa.PrivateKey, amount, currency string) (jwe string, plaintext []byte) {
-	header := jweHeader{
-		Alg:                    "RSA1_5",
-		Kid:                    Kid(key),
-		Typ:                    "JOSE",
-		ChannelSecurityContext: "RSA_PKI",
-		Enc:                    "A128GCM",
-	}
-	headerbs, _ := json.Marshal(header)
-
-	pc := paymentCredential{
-		Amount:             amount,
-		CurrencyCode:       currency,
-		Utc:                fmt.Sprintf("%d", time.Now().UnixMilli()),
-		EciIndicator:       "02",
-		TokenPAN:           visaTestCard.dpan,
-		TokenPanExpiration: visaTestCard.expiryMonth + visaTestCard.expiryYear,
-		Cryptogram:         testCryptogram,
-	}
-	plaintext, _ = json.Marshal(pc)
-
-	encryptionKey := keyGetter()
-	nonce := nonceGetter()
-
-	block, err := aes.NewCipher(encryptionKey)
-	if err != nil {
-		panic(err)
-	}
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		panic(err)
-	}
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
-
-	tag := ciphertext[len(ciphertext)-tagLength:]
-	ciphertext = ciphertext[:len(ciphertext)-tagLength]
-
-	encryptedKey, _ := rsa.EncryptPKCS1v15(rand.Reader, key.Public().(*rsa.PublicKey), encryptionKey)
-
-	headerPart := base64Decoder.EncodeToString(headerbs)
-	keyPart := base64Decoder.EncodeToString(encryptedKey)
-	noncePart := base64Decoder.EncodeToString(nonce)
-	payloadPart := base64Decoder.EncodeToString(ciphertext)
-	tagPart := base64Decoder.EncodeToString(tag)
-
-	return strings.Join([]string{
-		headerPart,
-		keyPart,
-		noncePart,
-		payloadPart,
-		tagPart,
-	}, "."), plaintext
+	return GetMockVisaWithPublicKey(&key.PublicKey, amount, currency)
 }
 
 // Produces a JWE and plaintext of an American Express test DPAN. Uses the test card listed on MPGS documentation:
 // https://ap-gateway.mastercard.com/api/documentation/integrationGuidelines/supportedFeatures/pickPaymentMethod/devicePayments/SamsungPay.html?locale=en_US
+// The amount is in minor units, or in major units if it has a decimal point, e.g. "1.5" KWD becomes "1500".
 func GetMockAmex(key *rsa.PrivateKey, amount, currency string) (jwe string, plaintext []byte) {
-	header := jweHeader{
-		Alg:                    "RSA1_5",
-		Kid:                    Kid(key),
-		Typ:                    "JOSE",
-		ChannelSecurityContext: "RSA_PKI",
-		Enc:                    "A128GCM",
-	}
-	headerbs, _ := json.Marshal(header)
-
-	pc := paymentCredential{
-		Amount:             amount,
-		CurrencyCode:       currency,
-		Utc:                fmt.Sprintf("%d", time.Now().UnixMilli()),
-		EciIndicator:       "02",
-		TokenPAN:           amexTestCard.dpan,
-		TokenPanExpiration: amexTestCard.expiryMonth + amexTestCard.expiryYear,
-		Cryptogram:         testCryptogram,
-	}
-	plaintext, _ = json.Marshal(pc)
-
-	encryptionKey := keyGetter()
-	nonce := nonceGetter()
-
-	block, err := aes.NewCipher(encryptionKey)
-	if err != nil {
-		panic(err)
-	}
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		panic(err)
-	}
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
-
-	tag := ciphertext[len(ciphertext)-tagLength:]
-	ciphertext = ciphertext[:len(ciphertext)-tagLength]
-
-	encryptedKey, _ := rsa.EncryptPKCS1v15(rand.Reader, key.Public().(*rsa.PublicKey), encryptionKey)
-
-	headerPart := base64Decoder.EncodeToString(headerbs)
-	keyPart := base64Decoder.EncodeToString(encryptedKey)
-	noncePart := base64Decoder.EncodeToString(nonce)
-	payloadPart := base64Decoder.EncodeToString(ciphertext)
-	tagPart := base64Decoder.EncodeToString(tag)
-
-	return strings.Join([]string{
-		headerPart,
-		keyPart,
-		noncePart,
-		payloadPart,
-		tagPart,
-	}, "."), plaintext
+	return GetMockAmexWithPublicKey(&key.PublicKey, amount, currency)
 }
@@ -0,0 +1,184 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Observer receives the events of the decryptors and key providers, for metrics.
+// The calls are synchronous and may be concurrent, so implementations must be safe
+// for concurrent use and return quickly. The events never carry sensitive values.
+type Observer interface {
+	DecryptStarted(DecryptStartedEvent)
+	DecryptFinished(DecryptFinishedEvent)
+	KeyLookup(KeyLookupEvent)
+}
+
+// DecryptStartedEvent is sent before a payload is parsed
+type DecryptStartedEvent struct {
+	// Version is the decryptor version, as passed to NewJWEDecryptor
+	Version string
+}
+
+// DecryptFinishedEvent is sent once a payload is decrypted or failed to decrypt.
+// The header values are as claimed by the payload, so they are not validated if
+// the decryption failed at StageParse or StageHeader.
+type DecryptFinishedEvent struct {
+	Version  string
+	Kid      string
+	Alg      string
+	Enc      string
+	Duration time.Duration
+	// Brand is detected from the decrypted credential, BrandUnknown if it failed
+	Brand Brand
+	// HeaderAuthenticated reports whether the content encryption authenticated the
+	// protected header, as RFC 7516 requires. It is false for Samsung Pay tokens.
+	HeaderAuthenticated bool
+	// Stage is the stage of the failure, empty on success
+	Stage Stage
+	Err   error
+}
+
+// KeyLookupEvent is sent once a key is looked up
+type KeyLookupEvent struct {
+	Kid      string
+	Found    bool
+	Duration time.Duration
+	// Err is ErrKeyNotFound if the key is missing, or the error of the provider
+	Err error
+}
+
+// WithObserver reports the decryptions and their key lookups to `o`.
+func WithObserver(o Observer) DecryptorOption {
+	return func(c *decryptorConfig) {
+		c.observer = o
+	}
+}
+
+// finish completes the event from the outcome of the decryption. The brand is
+// read from `plain` on success.
+func (e *DecryptFinishedEvent) finish(start time.Time, plain []byte, err error) {
+	e.Duration = time.Since(start)
+	e.Err = err
+	if err != nil {
+		var de *DecryptError
+		if errors.As(err, &de) {
+			e.Stage = de.Stage
+		}
+		return
+	}
+	if pc, err := ParseCredential(plain); err == nil {
+		e.Brand = pc.Brand
+	}
+}
+
+// ObserveKeyProvider wraps `p` to report its lookups to `o`. The decryptors given
+// WithObserver already report their lookups, so this is for providers used directly.
+func ObserveKeyProvider(p KeyProvider, o Observer) KeyProvider {
+	return observedProvider{provider: ContextKeyProviderOf(p), observer: o}
+}
+
+type observedProvider struct {
+	provider ContextKeyProvider
+	observer Observer
+}
+
+func (p observedProvider) GetKey(kid string) PrivateKey {
+	key, _ := p.GetKeyContext(context.Background(), kid)
+	return key
+}
+
+func (p observedProvider) GetKeyContext(ctx context.Context, kid string) (PrivateKey, error) {
+	return observeKeyLookup(ctx, p.provider, p.observer, kid)
+}
+
+// observeKeyLookup looks `kid` up, reporting the lookup to `o` unless nil
+func observeKeyLookup(ctx context.Context, p ContextKeyProvider, o Observer, kid string) (PrivateKey, error) {
+	if o == nil {
+		return p.GetKeyContext(ctx, kid)
+	}
+	start := time.Now()
+	key, err := p.GetKeyContext(ctx, kid)
+	if err == nil && key == nil {
+		err = ErrKeyNotFound
+	}
+	o.KeyLookup(KeyLookupEvent{Kid: kid, Found: err == nil, Duration: time.Since(start), Err: err})
+	return key, err
+}
+
+var _ KeyProvider = observedProvider{}
+var _ ContextKeyProvider = observedProvider{}
+
+// maxKidLabels bounds the distinct kids kept apart by the metrics adapters. The kid
+// of a token is whatever the payload claims, so a kid only gets its own label once
+// a lookup found its key; the other kids are counted as "unknown".
+const maxKidLabels = 64
+
+// maxKidLength is well above the 44 characters of the kids computed by Kid
+const maxKidLength = 128
+
+type kidLabels struct {
+	mu    sync.Mutex
+	found map[string]struct{}
+}
+
+// keyFound gives `kid` its own label, unless maxKidLabels kids already have one
+// or `kid` could not be a key ID
+func (l *kidLabels) keyFound(kid string) {
+	if kid == "" || len(kid) > maxKidLength || strings.IndexFunc(kid, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.found) >= maxKidLabels {
+		return
+	}
+	if l.found == nil {
+		l.found = make(map[string]struct{})
+	}
+	l.found[kid] = struct{}{}
+}
+
+// label is `kid` if its key was found, "none" if the token has no kid and
+// "unknown" otherwise
+func (l *kidLabels) label(kid string) string {
+	if kid == "" {
+		return "none"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.found[kid]; ok {
+		return kid
+	}
+	return "unknown"
+}
+
+func brandLabel(b Brand) string {
+	if b == BrandUnknown {
+		return "unknown"
+	}
+	return string(b)
+}
+
+// keyLookupResult is "hit", "miss" or "error"
+func keyLookupResult(e KeyLookupEvent) string {
+	switch {
+	case e.Found:
+		return "hit"
+	case errors.Is(e.Err, ErrKeyNotFound):
+		return "miss"
+	default:
+		return "error"
+	}
+}
+
+func stageLabel(s Stage) string {
+	if s == "" {
+		return "unknown"
+	}
+	return string(s)
+}
@@ -0,0 +1,236 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingObserver keeps the events it receives
+type recordingObserver struct {
+	mu       sync.Mutex
+	started  []DecryptStartedEvent
+	finished []DecryptFinishedEvent
+	lookups  []KeyLookupEvent
+}
+
+func (o *recordingObserver) DecryptStarted(e DecryptStartedEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, e)
+}
+
+func (o *recordingObserver) DecryptFinished(e DecryptFinishedEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, e)
+}
+
+func (o *recordingObserver) KeyLookup(e KeyLookupEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lookups = append(o.lookups, e)
+}
+
+func TestWithObserver(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "106000", "USD")
+	tests := []struct {
+		name        string
+		provider    KeyProvider
+		payload     string
+		wantStage   Stage
+		wantBrand   Brand
+		wantLookups []bool
+	}{
+		{
+			name:        "success",
+			provider:    NewMemoryKeyProvider(key),
+			payload:     jwe,
+			wantBrand:   BrandMastercard,
+			wantLookups: []bool{true},
+		},
+		{
+			name:        "missing key",
+			provider:    NewMemoryKeyProvider(),
+			payload:     jwe,
+			wantStage:   StageKeyLookup,
+			wantLookups: []bool{false},
+		},
+		{
+			name:      "malformed token",
+			provider:  NewMemoryKeyProvider(key),
+			payload:   "a.b.c",
+			wantStage: StageParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &recordingObserver{}
+			d := must(NewJWEDecryptor("100", tt.provider, WithObserver(o))).(AppendDecryptor)
+			_, err := d.DecryptTo([]byte("prefix"), []byte(tt.payload))
+			if (err != nil) != (tt.wantStage != "") {
+				t.Fatalf("DecryptTo() error = %v", err)
+			}
+			if len(o.started) != 1 || o.started[0].Version != "100" || len(o.finished) != 1 {
+				t.Fatalf("observed %d starts and %d finishes", len(o.started), len(o.finished))
+			}
+			got := o.finished[0]
+			if got.Stage != tt.wantStage || got.Brand != tt.wantBrand || !errors.Is(got.Err, err) || got.Duration <= 0 {
+				t.Errorf("DecryptFinished(%+v)", got)
+			}
+			if tt.wantStage != StageParse && (got.Kid != Kid(key) || got.Alg != AlgRSA1_5 || got.Enc != EncA128GCM) {
+				t.Errorf("DecryptFinished() header values = %s %s %s", got.Kid, got.Alg, got.Enc)
+			}
+			if len(o.lookups) != len(tt.wantLookups) {
+				t.Fatalf("observed %d key lookups, want %d", len(o.lookups), len(tt.wantLookups))
+			}
+			for i, found := range tt.wantLookups {
+				if o.lookups[i].Found != found || o.lookups[i].Kid != Kid(key) {
+					t.Errorf("KeyLookup(%+v), want found %v", o.lookups[i], found)
+				}
+			}
+		})
+	}
+}
+
+func TestObserveKeyProvider(t *testing.T) {
+	key := getKey()
+	o := &recordingObserver{}
+	p := ObserveKeyProvider(NewMemoryKeyProvider(key), o)
+	p.GetKey(Kid(key))
+	p.GetKey("unknown")
+	if len(o.lookups) != 2 || !o.lookups[0].Found || o.lookups[1].Found || !errors.Is(o.lookups[1].Err, ErrKeyNotFound) {
+		t.Errorf("KeyLookup events = %+v", o.lookups)
+	}
+}
+
+func TestKidLabels(t *testing.T) {
+	var l kidLabels
+	for i := 0; i < maxKidLabels; i++ {
+		l.keyFound(fmt.Sprintf("kid-%d", i))
+	}
+	l.keyFound("one too many")
+	l.keyFound("nul\x00")
+	for kid, want := range map[string]string{
+		"kid-0":                  "kid-0",
+		"kid-63":                 "kid-63",
+		"one too many":           "unknown",
+		"never found":            "unknown",
+		"":                       "none",
+		"nul\x00":                "unknown",
+		strings.Repeat("k", 200): "unknown",
+	} {
+		if got := l.label(kid); got != want {
+			t.Errorf("label(%q) = %s, want %s", kid, got, want)
+		}
+	}
+}
+
+func TestKidLabelsIgnoreMissedKids(t *testing.T) {
+	o := NewPrometheusObserver("")
+	// garbage tokens cannot take the labels of the kids found later
+	for i := 0; i < 2*maxKidLabels; i++ {
+		kid := fmt.Sprintf("garbage-%d", i)
+		o.KeyLookup(KeyLookupEvent{Kid: kid, Err: ErrKeyNotFound})
+		o.DecryptFinished(DecryptFinishedEvent{Version: "100", Kid: kid, Stage: StageKeyLookup, Err: ErrKeyNotFound})
+	}
+	o.KeyLookup(KeyLookupEvent{Kid: "real", Found: true})
+	o.DecryptFinished(DecryptFinishedEvent{Version: "100", Kid: "real", Stage: StageContentDecrypt, Err: ErrAuthenticationFailed})
+
+	var b bytes.Buffer
+	o.WriteTo(&b)
+	for _, line := range []string{
+		`samsungpay_decryption_failures_total{version="100",kid="real",stage="content_decrypt"} 1`,
+		fmt.Sprintf(`samsungpay_decryption_failures_total{version="100",kid="unknown",stage="key_lookup"} %d`, 2*maxKidLabels),
+		fmt.Sprintf(`samsungpay_key_lookups_total{kid="unknown",result="miss"} %d`, 2*maxKidLabels),
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("metrics lack %s\n%s", line, b.String())
+		}
+	}
+}
+
+// observeDecryptions feeds a success, a failure and two key lookups to `o`
+func observeDecryptions(o Observer, kid string) {
+	o.DecryptStarted(DecryptStartedEvent{Version: "100"})
+	o.DecryptStarted(DecryptStartedEvent{Version: "100"})
+	o.DecryptStarted(DecryptStartedEvent{Version: "100"})
+	o.KeyLookup(KeyLookupEvent{Kid: kid, Found: true})
+	o.DecryptFinished(DecryptFinishedEvent{Version: "100", Kid: kid, Brand: BrandVisa, Duration: 2 * time.Millisecond})
+	o.KeyLookup(KeyLookupEvent{Kid: "gone", Err: ErrKeyNotFound})
+	o.DecryptFinished(DecryptFinishedEvent{Version: "100", Kid: "gone", Duration: 30 * time.Microsecond, Stage: StageKeyLookup, Err: ErrKeyNotFound})
+}
+
+// expvarRuns names the map of each run, as expvar names cannot be published twice
+var expvarRuns atomic.Int32
+
+func TestExpvarObserver(t *testing.T) {
+	name := fmt.Sprintf("samsungpay_test_%d", expvarRuns.Add(1))
+	observeDecryptions(NewExpvarObserver(name), "k1")
+	var got map[string]any
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"decryptions_started":      3.0,
+		"decryptions_succeeded":    1.0,
+		"decryptions_failed":       1.0,
+		"decryptions_in_flight":    1.0,
+		"decryption_seconds_total": 0.00203,
+		"decryptions_by_kid":       map[string]any{"k1": 1.0, "unknown": 1.0},
+		"decryptions_by_brand":     map[string]any{"visa": 1.0},
+		"failures_by_kid":          map[string]any{"unknown": 1.0},
+		"failures_by_stage":        map[string]any{"key_lookup": 1.0},
+		"key_lookups_by_result":    map[string]any{"hit": 1.0, "miss": 1.0},
+		"key_misses_by_kid":        map[string]any{"unknown": 1.0},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expvar map = %v\nwant %v", got, want)
+	}
+}
+
+func TestPrometheusObserver(t *testing.T) {
+	o := NewPrometheusObserver("")
+	observeDecryptions(o, `k"1`)
+
+	rec := httptest.NewRecorder()
+	o.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	got := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE samsungpay_decryptions_total counter",
+		`samsungpay_decryptions_total{version="100",kid="k\"1",brand="visa"} 1`,
+		`samsungpay_decryptions_total{version="100",kid="unknown",brand="unknown"} 1`,
+		`samsungpay_decryption_failures_total{version="100",kid="unknown",stage="key_lookup"} 1`,
+		"samsungpay_decryptions_in_flight 1",
+		"# TYPE samsungpay_decryption_duration_seconds histogram",
+		`samsungpay_decryption_duration_seconds_bucket{version="100",le="0.0005"} 1`,
+		`samsungpay_decryption_duration_seconds_bucket{version="100",le="0.001"} 1`,
+		`samsungpay_decryption_duration_seconds_bucket{version="100",le="0.0025"} 2`,
+		`samsungpay_decryption_duration_seconds_bucket{version="100",le="+Inf"} 2`,
+		`samsungpay_decryption_duration_seconds_sum{version="100"} 0.00203`,
+		`samsungpay_decryption_duration_seconds_count{version="100"} 2`,
+		`samsungpay_key_lookups_total{kid="unknown",result="miss"} 1`,
+		`samsungpay_key_lookups_total{kid="k\"1",result="hit"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("metrics lack %s\n%s", line, got)
+		}
+	}
+
+	var b bytes.Buffer
+	if n, err := o.WriteTo(&b); err != nil || n != int64(b.Len()) || b.String() != got {
+		t.Errorf("WriteTo() = %d, %v, differing from ServeHTTP", n, err)
+	}
+}
@@ -0,0 +1,60 @@
+package samsungpaycodec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExpectedOrder is the transaction the merchant intends to charge, against which
+// a decrypted credential is verified.
+type ExpectedOrder struct {
+	// Amount in the minor units of the currency, e.g. cents for USD
+	Amount int64
+	// Currency is the ISO 4217 alphabetic or numeric code, e.g. "USD" or "840"
+	Currency string
+}
+
+// OrderMismatchError reports the field of the credential disagreeing with the
+// expected order. It matches ErrOrderMismatch with errors.Is.
+type OrderMismatchError struct {
+	// Field is the credential field, "amount" or "currency_code"
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (e *OrderMismatchError) Error() string {
+	return fmt.Sprintf("%v: %s is '%s', expected '%s'", ErrOrderMismatch, e.Field, e.Actual, e.Expected)
+}
+
+func (e *OrderMismatchError) Is(target error) bool {
+	return target == ErrOrderMismatch
+}
+
+// VerifyOrder checks the credential is for the amount and currency of `order`.
+// It returns an *OrderMismatchError if they disagree, or an ErrMalformedCredential
+// if the amount cannot be read.
+func (c PaymentCredential) VerifyOrder(order ExpectedOrder) error {
+	if !sameCurrency(c.CurrencyCode, order.Currency) {
+		return &OrderMismatchError{Field: "currency_code", Expected: order.Currency, Actual: c.CurrencyCode}
+	}
+	amount, err := c.AmountMinorUnits()
+	if err != nil {
+		return err
+	}
+	if amount != order.Amount {
+		return &OrderMismatchError{Field: "amount", Expected: fmt.Sprint(order.Amount), Actual: fmt.Sprint(amount)}
+	}
+	return nil
+}
+
+// sameCurrency compares ISO 4217 currencies given by alphabetic or numeric code,
+// falling back to comparing the codes as text for those not in the table.
+func sameCurrency(a, b string) bool {
+	ca, errA := LookupCurrency(a)
+	cb, errB := LookupCurrency(b)
+	if errA == nil && errB == nil {
+		return ca == cb
+	}
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
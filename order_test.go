@@ -0,0 +1,68 @@
+package samsungpaycodec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyOrder(t *testing.T) {
+	pc := PaymentCredential{Amount: "106000", CurrencyCode: "USD"}
+	tests := []struct {
+		name      string
+		pc        PaymentCredential
+		order     ExpectedOrder
+		wantErr   error
+		wantField string
+	}{
+		{
+			name:  "matching order",
+			pc:    pc,
+			order: ExpectedOrder{Amount: 106000, Currency: "USD"},
+		},
+		{
+			name:  "currency is compared case-insensitively",
+			pc:    pc,
+			order: ExpectedOrder{Amount: 106000, Currency: "usd"},
+		},
+		{
+			name:  "currency may be given by numeric code",
+			pc:    pc,
+			order: ExpectedOrder{Amount: 106000, Currency: "840"},
+		},
+		{
+			name:      "different amount",
+			pc:        pc,
+			order:     ExpectedOrder{Amount: 1060, Currency: "USD"},
+			wantErr:   ErrOrderMismatch,
+			wantField: "amount",
+		},
+		{
+			name:      "different currency",
+			pc:        pc,
+			order:     ExpectedOrder{Amount: 106000, Currency: "SAR"},
+			wantErr:   ErrOrderMismatch,
+			wantField: "currency_code",
+		},
+		{
+			name:    "unreadable amount",
+			pc:      PaymentCredential{Amount: "1,060.00", CurrencyCode: "USD"},
+			order:   ExpectedOrder{Amount: 106000, Currency: "USD"},
+			wantErr: ErrMalformedCredential,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pc.VerifyOrder(tt.order)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			var mismatch *OrderMismatchError
+			if errors.As(err, &mismatch) != (tt.wantField != "") {
+				t.Fatalf("VerifyOrder() error = %T", err)
+			}
+			if mismatch != nil && mismatch.Field != tt.wantField {
+				t.Errorf("OrderMismatchError.Field = %s, want %s", mismatch.Field, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// durationBuckets are the upper bounds in seconds of the decryption duration
+// histogram. An RSA-2048 decryption takes a couple of milliseconds.
+var durationBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// PrometheusObserver is an Observer keeping its metrics in memory and exposing them
+// in the Prometheus text format, without a dependency on the Prometheus client. The
+// metrics, prefixed by the namespace, are:
+//
+//   - decryptions_total{version,kid,brand}, the decryptions finished, failed or not
+//   - decryption_failures_total{version,kid,stage}
+//   - decryptions_in_flight
+//   - decryption_duration_seconds{version}, a histogram
+//   - key_lookups_total{kid,result}, result being hit, miss or error
+//
+// The kid label is "unknown" for the kids whose key no lookup found.
+type PrometheusObserver struct {
+	namespace string
+
+	mu sync.Mutex
+	// the counters are keyed by their label values, see seriesKey
+	decryptions map[string]uint64
+	failures    map[string]uint64
+	keyLookups  map[string]uint64
+	inFlight    int64
+	durations   map[string]*histogram
+
+	kids kidLabels
+}
+
+type histogram struct {
+	counts []uint64 // per bucket of durationBuckets, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheusObserver returns a PrometheusObserver whose metric names start with
+// `namespace`, "samsungpay" if empty.
+func NewPrometheusObserver(namespace string) *PrometheusObserver {
+	if namespace == "" {
+		namespace = "samsungpay"
+	}
+	return &PrometheusObserver{
+		namespace:   namespace,
+		decryptions: make(map[string]uint64),
+		failures:    make(map[string]uint64),
+		keyLookups:  make(map[string]uint64),
+		durations:   make(map[string]*histogram),
+	}
+}
+
+func (o *PrometheusObserver) DecryptStarted(DecryptStartedEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.inFlight++
+}
+
+func (o *PrometheusObserver) DecryptFinished(e DecryptFinishedEvent) {
+	kid := o.kids.label(e.Kid)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.inFlight--
+	if e.Err != nil {
+		o.failures[seriesKey(e.Version, kid, stageLabel(e.Stage))]++
+	}
+	o.decryptions[seriesKey(e.Version, kid, brandLabel(e.Brand))]++
+
+	h, ok := o.durations[e.Version]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		o.durations[e.Version] = h
+	}
+	seconds := e.Duration.Seconds()
+	if i, _ := slices.BinarySearch(durationBuckets, seconds); i < len(durationBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (o *PrometheusObserver) KeyLookup(e KeyLookupEvent) {
+	if e.Found {
+		o.kids.keyFound(e.Kid)
+	}
+	kid := o.kids.label(e.Kid)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.keyLookups[seriesKey(kid, keyLookupResult(e))]++
+}
+
+// WriteTo writes the metrics to `w` in the Prometheus text format.
+func (o *PrometheusObserver) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	o.mu.Lock()
+	o.writeCounter(&b, "decryptions_total", "Decryptions finished, failed or not.", []string{"version", "kid", "brand"}, o.decryptions)
+	o.writeCounter(&b, "decryption_failures_total", "Decryptions failed, by the stage of the failure.", []string{"version", "kid", "stage"}, o.failures)
+
+	name := o.namespace + "_decryptions_in_flight"
+	fmt.Fprintf(&b, "# HELP %s Decryptions started and not yet finished.\n# TYPE %s gauge\n%s %d\n", name, name, name, o.inFlight)
+
+	name = o.namespace + "_decryption_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Duration of the decryptions.\n# TYPE %s histogram\n", name, name)
+	for _, version := range sortedKeys(o.durations) {
+		h := o.durations[version]
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "%s_bucket{version=%s,le=\"%s\"} %d\n", name, quoteLabel(version), strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket{version=%s,le=\"+Inf\"} %d\n", name, quoteLabel(version), h.count)
+		fmt.Fprintf(&b, "%s_sum{version=%s} %s\n", name, quoteLabel(version), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{version=%s} %d\n", name, quoteLabel(version), h.count)
+	}
+
+	o.writeCounter(&b, "key_lookups_total", "Key lookups, by result: hit, miss or error.", []string{"kid", "result"}, o.keyLookups)
+	o.mu.Unlock()
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape.
+func (o *PrometheusObserver) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = o.WriteTo(w)
+}
+
+// writeCounter writes the counter `name` whose series are keyed by seriesKey
+func (o *PrometheusObserver) writeCounter(b *bytes.Buffer, name, help string, labels []string, series map[string]uint64) {
+	name = o.namespace + "_" + name
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(series) {
+		values := strings.Split(key, "\x00")
+		pairs := make([]string, len(labels))
+		for i, l := range labels {
+			pairs[i] = l + "=" + quoteLabel(values[i])
+		}
+		fmt.Fprintf(b, "%s{%s} %d\n", name, strings.Join(pairs, ","), series[key])
+	}
+}
+
+// seriesKey joins label values with NUL, which the values cannot contain
+func seriesKey(values ...string) string {
+	return strings.Join(values, "\x00")
+}
+
+// quoteLabel quotes a label value, escaping per the text format
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+var _ Observer = &PrometheusObserver{}
+var _ http.Handler = &PrometheusObserver{}
+var _ io.WriterTo = &PrometheusObserver{}
@@ -0,0 +1,218 @@
+package samsungpaycodec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// redacted replaces sensitive values that are never shown, even partially
+const redacted = "[REDACTED]"
+
+// MaskPAN masks all but the first 6 and last 4 digits of `pan`, the most PCI DSS allows
+// to be displayed. PANs shorter than 13 digits keep only the last 4.
+func MaskPAN(pan string) string {
+	switch {
+	case len(pan) >= 13:
+		return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+	case len(pan) > 4:
+		return strings.Repeat("*", len(pan)-4) + pan[len(pan)-4:]
+	default:
+		return strings.Repeat("*", len(pan))
+	}
+}
+
+// safeStringer is implemented by the types whose default formatting would expose
+// sensitive values
+type safeStringer interface {
+	fmt.Stringer
+	fmt.GoStringer
+}
+
+// formatSafe writes the redacted form of `v` for any verb, so that neither %v nor
+// %x and friends fall back to printing the fields.
+func formatSafe(f fmt.State, verb rune, v safeStringer) {
+	switch verb {
+	case 'v':
+		if f.Flag('#') {
+			_, _ = io.WriteString(f, v.GoString())
+			return
+		}
+		_, _ = io.WriteString(f, v.String())
+	case 's':
+		_, _ = io.WriteString(f, v.String())
+	case 'q':
+		_, _ = fmt.Fprintf(f, "%q", v.String())
+	default:
+		_, _ = fmt.Fprintf(f, "%%!%c(%s)", verb, v.String())
+	}
+}
+
+// RawPAN returns the unmasked `tokenPAN`. The DPAN is masked whenever the
+// credential is formatted or logged.
+func (c PaymentCredential) RawPAN() string {
+	return c.TokenPAN
+}
+
+// RawCryptogram returns the `cryptogram`. It is redacted whenever the credential
+// is formatted or logged.
+func (c PaymentCredential) RawCryptogram() string {
+	return c.Cryptogram
+}
+
+// String formats the credential with the PAN masked and the cryptogram redacted.
+func (c PaymentCredential) String() string {
+	return fmt.Sprintf("{amount:%s currency_code:%s utc:%s eci_indicator:%s tokenPAN:%s tokenPanExpiration:%s cryptogram:%s brand:%s}",
+		c.Amount, c.CurrencyCode, c.Utc, c.EciIndicator, MaskPAN(c.TokenPAN), c.TokenPanExpiration, c.redactedCryptogram(), c.Brand)
+}
+
+// GoString is String in Go syntax, for %#v.
+func (c PaymentCredential) GoString() string {
+	return fmt.Sprintf("samsungpaycodec.PaymentCredential{Amount:%q, CurrencyCode:%q, Utc:%q, EciIndicator:%q, TokenPAN:%q, TokenPanExpiration:%q, Cryptogram:%q, Brand:%q}",
+		c.Amount, c.CurrencyCode, c.Utc, c.EciIndicator, MaskPAN(c.TokenPAN), c.TokenPanExpiration, c.redactedCryptogram(), c.Brand)
+}
+
+// Format implements fmt.Formatter so that every verb prints the redacted form.
+func (c PaymentCredential) Format(f fmt.State, verb rune) {
+	formatSafe(f, verb, c)
+}
+
+// LogValue implements slog.LogValuer with the PAN masked and the cryptogram redacted.
+func (c PaymentCredential) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("amount", c.Amount),
+		slog.String("currency_code", c.CurrencyCode),
+		slog.String("utc", c.Utc),
+		slog.String("eci_indicator", c.EciIndicator),
+		slog.String("tokenPAN", MaskPAN(c.TokenPAN)),
+		slog.String("tokenPanExpiration", c.TokenPanExpiration),
+		slog.String("cryptogram", c.redactedCryptogram()),
+		slog.String("brand", string(c.Brand)),
+	)
+}
+
+// credentialWire is PaymentCredential without its methods, to encode it as received
+type credentialWire PaymentCredential
+
+// MarshalJSON encodes the credential with the PAN masked and the cryptogram redacted,
+// so that it is also redacted as a field of a value logged by slog.JSONHandler, which
+// encodes nested values with encoding/json rather than LogValue. Forward the
+// plaintext of the decryptor, not a re-encoded credential, to pass it on.
+func (c PaymentCredential) MarshalJSON() ([]byte, error) {
+	c.TokenPAN = MaskPAN(c.TokenPAN)
+	c.Cryptogram = c.redactedCryptogram()
+	return json.Marshal(credentialWire(c))
+}
+
+// redactedCryptogram keeps an absent cryptogram distinguishable from a present one
+func (c PaymentCredential) redactedCryptogram() string {
+	if c.Cryptogram == "" {
+		return ""
+	}
+	return redacted
+}
+
+// kids lists the key IDs held by the provider; the keys themselves are never formatted
+func (sp memoryProvider) kids() []string {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sortedKeys(sp.keys)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (sp memoryProvider) String() string {
+	return fmt.Sprintf("memoryProvider{kids:%v}", sp.kids())
+}
+
+func (sp memoryProvider) GoString() string {
+	return fmt.Sprintf("&samsungpaycodec.memoryProvider{kids:%#v}", sp.kids())
+}
+
+func (sp memoryProvider) Format(f fmt.State, verb rune) {
+	formatSafe(f, verb, sp)
+}
+
+func (sp memoryProvider) LogValue() slog.Value {
+	return slog.GroupValue(slog.Any("kids", sp.kids()))
+}
+
+func (p filesystemKeyProvider) kids() []string {
+	p.kidMu.RLock()
+	defer p.kidMu.RUnlock()
+	return sortedKeys(p.keys)
+}
+
+func (p filesystemKeyProvider) String() string {
+	return fmt.Sprintf("filesystemKeyProvider{root:%s kids:%v}", p.root, p.kids())
+}
+
+func (p filesystemKeyProvider) GoString() string {
+	return fmt.Sprintf("&samsungpaycodec.filesystemKeyProvider{root:%q, kids:%#v}", p.root, p.kids())
+}
+
+func (p filesystemKeyProvider) Format(f fmt.State, verb rune) {
+	formatSafe(f, verb, p)
+}
+
+func (p filesystemKeyProvider) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("root", p.root), slog.Any("kids", p.kids()))
+}
+
+// The decryptors hold their provider in an unexported field, which fmt prints
+// without consulting its methods; only its type is shown.
+
+func (d jweRSADecryptorV100) String() string {
+	return fmt.Sprintf("jweRSADecryptorV100{provider:%T}", d.provider)
+}
+
+func (d jweRSADecryptorV100) GoString() string {
+	return fmt.Sprintf("samsungpaycodec.jweRSADecryptorV100{provider:%T}", d.provider)
+}
+
+func (d jweRSADecryptorV100) Format(f fmt.State, verb rune) {
+	formatSafe(f, verb, d)
+}
+
+func (d jweRSADecryptorV100) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("provider", fmt.Sprintf("%T", d.provider)))
+}
+
+func (g replayGuard) String() string {
+	return fmt.Sprintf("replayGuard{decryptor:%T store:%T}", g.decryptor, g.policy.Store)
+}
+
+func (g replayGuard) GoString() string {
+	return fmt.Sprintf("samsungpaycodec.replayGuard{decryptor:%T, store:%T}", g.decryptor, g.policy.Store)
+}
+
+func (g replayGuard) Format(f fmt.State, verb rune) {
+	formatSafe(f, verb, g)
+}
+
+func (g replayGuard) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("decryptor", fmt.Sprintf("%T", g.decryptor)),
+		slog.String("store", fmt.Sprintf("%T", g.policy.Store)),
+	)
+}
+
+var _ slog.LogValuer = PaymentCredential{}
+var _ fmt.Formatter = PaymentCredential{}
+var _ json.Marshaler = PaymentCredential{}
+var _ slog.LogValuer = memoryProvider{}
+var _ fmt.Formatter = memoryProvider{}
+var _ slog.LogValuer = filesystemKeyProvider{}
+var _ fmt.Formatter = filesystemKeyProvider{}
+var _ fmt.Formatter = jweRSADecryptorV100{}
+var _ fmt.Formatter = replayGuard{}
@@ -0,0 +1,87 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestMaskPAN(t *testing.T) {
+	tests := []struct {
+		pan  string
+		want string
+	}{
+		{pan: "5123456789012346", want: "512345******2346"},
+		{pan: "340353278080900", want: "340353*****0900"},
+		{pan: "4440000009900010123", want: "444000*********0123"},
+		{pan: "123456789012", want: "********9012"},
+		{pan: "1234", want: "****"},
+		{pan: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := MaskPAN(tt.pan); got != tt.want {
+			t.Errorf("MaskPAN(%s) = %s, want %s", tt.pan, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentCredentialRedaction(t *testing.T) {
+	pc := mockCredential(mastercardTestCard, "106000", "USD")
+	pc.Brand = BrandMastercard
+
+	var logs bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("decrypted", "credential", pc, "ptr", &pc)
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("decrypted", "credential", pc)
+	// JSONHandler encodes nested values with encoding/json, bypassing LogValue
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("request", "r", struct{ C PaymentCredential }{pc})
+	encoded, _ := json.Marshal(struct{ C *PaymentCredential }{&pc})
+
+	outputs := map[string]string{
+		"%v":     fmt.Sprintf("%v", pc),
+		"%+v":    fmt.Sprintf("%+v", pc),
+		"%#v":    fmt.Sprintf("%#v", pc),
+		"%s":     fmt.Sprintf("%s", pc),
+		"%q":     fmt.Sprintf("%q", pc),
+		"%x":     fmt.Sprintf("%x", pc),
+		"ptr":    fmt.Sprintf("%v", &pc),
+		"Sprint": fmt.Sprint(pc),
+		"slog":   logs.String(),
+		"json":   string(encoded),
+	}
+	for name, out := range outputs {
+		if strings.Contains(out, pc.RawPAN()) || strings.Contains(out, pc.RawCryptogram()) {
+			t.Errorf("%s leaks the credential: %s", name, out)
+		}
+		if !strings.Contains(out, "512345******2346") {
+			t.Errorf("%s does not show the masked PAN: %s", name, out)
+		}
+	}
+	if pc.RawPAN() != mastercardTestCard.dpan || pc.RawCryptogram() != testCryptogram {
+		t.Errorf("raw accessors = %s, %s", pc.RawPAN(), pc.RawCryptogram())
+	}
+}
+
+func TestKeyHoldersRedaction(t *testing.T) {
+	key := getRSAKey()
+	provider := NewMemoryKeyProvider(key)
+	fsProvider := mustProvider(NewFilesystemKeyProvider("testdata/fs/single-key"))
+	d := must(NewJWEDecryptor("100", provider))
+	guard := NewReplayGuard(d, ReplayPolicy{Store: NewMemoryReplayStore()})
+	secret := key.D.String()
+
+	for _, v := range []any{provider, fsProvider, d, guard} {
+		var logs bytes.Buffer
+		slog.New(slog.NewTextHandler(&logs, nil)).Info("configured", "value", v)
+		for _, out := range []string{fmt.Sprintf("%v", v), fmt.Sprintf("%+v", v), fmt.Sprintf("%#v", v), logs.String()} {
+			if strings.Contains(out, secret) || strings.Contains(out, key.Primes[0].String()) {
+				t.Errorf("%T formatting leaks the private key: %s", v, out)
+			}
+		}
+	}
+	if got := fmt.Sprint(provider); got != fmt.Sprintf("memoryProvider{kids:[%s]}", Kid(key)) {
+		t.Errorf("memoryProvider formats as %s", got)
+	}
+}
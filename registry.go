@@ -0,0 +1,57 @@
+package samsungpaycodec
+
+import (
+	"sort"
+	"sync"
+)
+
+// DecryptorFactory produces the decryptor of a spec version using `provider` for
+// key retrieval. The options are those given to NewJWEDecryptor; factories wrapping
+// a built-in version pass them along to NewJWEDecryptor, others may ignore them.
+type DecryptorFactory func(provider KeyProvider, opts ...DecryptorOption) (Decryptor, error)
+
+var (
+	versionsMu sync.RWMutex
+	versions   = make(map[string]DecryptorFactory)
+)
+
+// RegisterVersion makes the decryptor produced by `factory` available to NewJWEDecryptor
+// and DecryptEnvelope under `version`. It is meant to be called from an init function.
+// It panics if `factory` is nil or if the version is already registered.
+func RegisterVersion(version string, factory DecryptorFactory) {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	if factory == nil {
+		panic("samsungpaycodec: RegisterVersion factory is nil")
+	}
+	if _, dup := versions[version]; dup {
+		panic("samsungpaycodec: RegisterVersion called twice for version " + version)
+	}
+	versions[version] = factory
+}
+
+// Versions returns the sorted list of registered versions
+func Versions() []string {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+	list := make([]string, 0, len(versions))
+	for v := range versions {
+		list = append(list, v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// unregisterVersion removes `version`, so that tests leave the registry as they found it
+func unregisterVersion(version string) {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	delete(versions, version)
+}
+
+func lookupVersion(version string) (DecryptorFactory, bool) {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+	factory, ok := versions[version]
+	return factory, ok
+}
@@ -0,0 +1,55 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// reversingDecryptor stands in for an in-house experimental decryptor
+type reversingDecryptor struct{}
+
+func (reversingDecryptor) Decrypt3DSData(payload []byte) ([]byte, error) {
+	plain := bytes.Clone(payload)
+	slices.Reverse(plain)
+	return plain, nil
+}
+
+func TestRegisterVersion(t *testing.T) {
+	RegisterVersion("test-reversing", func(provider KeyProvider, opts ...DecryptorOption) (Decryptor, error) {
+		return reversingDecryptor{}, nil
+	})
+	// registrations are process-wide, so the other tests must not see this one
+	t.Cleanup(func() { unregisterVersion("test-reversing") })
+	if !slices.Contains(Versions(), "test-reversing") || !slices.Contains(Versions(), "100") {
+		t.Errorf("Versions() = %v, want 100 and test-reversing", Versions())
+	}
+	if !slices.IsSorted(Versions()) {
+		t.Errorf("Versions() = %v, want sorted", Versions())
+	}
+
+	d, err := NewJWEDecryptor("test-reversing", NewMemoryKeyProvider())
+	if err != nil {
+		t.Fatalf("NewJWEDecryptor() error = %v", err)
+	}
+	if got, _ := d.Decrypt3DSData([]byte("abc")); string(got) != "cba" {
+		t.Errorf("Decrypt3DSData() = %s, want cba", got)
+	}
+
+	for name, register := range map[string]func(){
+		"duplicate version": func() { RegisterVersion("100", newJWERSADecryptorV100) },
+		"nil factory":       func() { RegisterVersion("test-nil", nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("RegisterVersion() did not panic")
+				}
+			}()
+			register()
+		})
+	}
+	if _, ok := lookupVersion("test-nil"); ok {
+		t.Error("RegisterVersion() registered a nil factory")
+	}
+}
@@ -0,0 +1,162 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReplayMaxAge is the age of the credential `utc` accepted when ReplayPolicy.MaxAge is zero
+	DefaultReplayMaxAge = 15 * time.Minute
+	// DefaultReplayMaxFutureSkew is the clock skew accepted when ReplayPolicy.MaxFutureSkew is zero
+	DefaultReplayMaxFutureSkew = time.Minute
+)
+
+// ReplayStore remembers the tokens already decrypted by a replay guard.
+type ReplayStore interface {
+	// CheckAndStore records `digest` for `ttl` and reports whether it was already recorded.
+	// It must be atomic so concurrent submissions of the same token are caught.
+	CheckAndStore(ctx context.Context, digest string, ttl time.Duration) (seen bool, err error)
+}
+
+// ReplayPolicy configures the guard returned by NewReplayGuard
+type ReplayPolicy struct {
+	// MaxAge is how far in the past the credential `utc` may be
+	MaxAge time.Duration
+	// MaxFutureSkew is how far in the future the credential `utc` may be, to
+	// tolerate clock differences with the device
+	MaxFutureSkew time.Duration
+	// Store tracks the tokens already seen. Tokens are only checked against the
+	// time window if nil.
+	Store ReplayStore
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewReplayGuard wraps `d` to reject credentials whose `utc` is outside the window
+// of `policy`, and tokens that were already decrypted within that window. Tokens
+// are recorded only once they decrypt successfully, so garbage cannot fill the store.
+func NewReplayGuard(d Decryptor, policy ReplayPolicy) Decryptor {
+	if policy.MaxAge <= 0 {
+		policy.MaxAge = DefaultReplayMaxAge
+	}
+	if policy.MaxFutureSkew <= 0 {
+		policy.MaxFutureSkew = DefaultReplayMaxFutureSkew
+	}
+	if policy.Now == nil {
+		policy.Now = time.Now
+	}
+	return replayGuard{decryptor: ContextDecryptorOf(d), policy: policy}
+}
+
+type replayGuard struct {
+	decryptor ContextDecryptor
+	policy    ReplayPolicy
+}
+
+func (g replayGuard) Decrypt3DSData(payload []byte) ([]byte, error) {
+	return g.Decrypt3DSDataContext(context.Background(), payload)
+}
+
+func (g replayGuard) Decrypt3DSDataContext(ctx context.Context, payload []byte) ([]byte, error) {
+	plain, err := g.decryptor.Decrypt3DSDataContext(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	digest, kid := replayDigest(payload)
+	// a rejected token is the plaintext least wanted around, so it is cleared
+	fail := func(err error) ([]byte, error) {
+		clear(plain)
+		return nil, &DecryptError{Stage: StageReplay, Kid: kid, Err: err}
+	}
+
+	pc, err := ParseCredential(plain)
+	if err != nil {
+		return fail(err)
+	}
+	ts, err := pc.Timestamp()
+	if err != nil {
+		return fail(err)
+	}
+	now := g.policy.Now()
+	if age := now.Sub(ts); age > g.policy.MaxAge {
+		return fail(fmt.Errorf("%w: generated %s ago", ErrStaleCredential, age.Truncate(time.Second)))
+	}
+	if ahead := ts.Sub(now); ahead > g.policy.MaxFutureSkew {
+		return fail(fmt.Errorf("%w: generated %s in the future", ErrFutureCredential, ahead.Truncate(time.Second)))
+	}
+
+	if g.policy.Store == nil {
+		return plain, nil
+	}
+	// past the window the timestamp check alone rejects the token
+	seen, err := g.policy.Store.CheckAndStore(ctx, digest, g.policy.MaxAge+g.policy.MaxFutureSkew)
+	if err != nil {
+		return fail(err)
+	}
+	if seen {
+		return fail(ErrReplayDetected)
+	}
+	return plain, nil
+}
+
+// replayDigest identifies the token by its decoded IV, ciphertext and tag, which
+// are authenticated and canonical, unlike the encoded form or the header Samsung
+// Pay leaves unauthenticated. Payloads of other formats are hashed as-is.
+func replayDigest(payload []byte) (digest, kid string) {
+	h := sha256.New()
+	if jwe, err := parseCompact(payload, len(payload)); err == nil {
+		h.Write(jwe.iv)
+		h.Write(jwe.ciphertext)
+		h.Write(jwe.tag)
+		kid = jwe.header.Kid
+		jwe.release()
+	} else {
+		h.Write(payload)
+	}
+	return hex.EncodeToString(h.Sum(nil)), kid
+}
+
+// NewMemoryReplayStore returns a ReplayStore holding the digests in memory until
+// their TTL passes. It is suitable for a single instance; deployments with several
+// instances need a shared store.
+func NewMemoryReplayStore() ReplayStore {
+	return &memoryReplayStore{seen: make(map[string]time.Time), now: time.Now}
+}
+
+type memoryReplayStore struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func (s *memoryReplayStore) CheckAndStore(ctx context.Context, digest string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.After(s.nextSweep) {
+		for d, expiry := range s.seen {
+			if now.After(expiry) {
+				delete(s.seen, d)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+	if expiry, ok := s.seen[digest]; ok && !now.After(expiry) {
+		return true, nil
+	}
+	s.seen[digest] = now.Add(ttl)
+	return false, nil
+}
+
+var _ Decryptor = replayGuard{}
+var _ ContextDecryptor = replayGuard{}
+var _ ReplayStore = &memoryReplayStore{}
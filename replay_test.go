@@ -0,0 +1,117 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayGuard(t *testing.T) {
+	key := getRSAKey()
+	d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key)))
+	jwe, pt := GetMockMastercard(key, "100", "SAR")
+	clock := func(offset time.Duration) func() time.Time {
+		return func() time.Time { return time.Now().Add(offset) }
+	}
+
+	t.Run("fresh token is accepted once", func(t *testing.T) {
+		guard := NewReplayGuard(d, ReplayPolicy{MaxAge: time.Minute, Store: NewMemoryReplayStore()})
+		got, err := guard.Decrypt3DSData([]byte(jwe))
+		if err != nil {
+			t.Fatalf("Decrypt3DSData() error = %v", err)
+		}
+		if string(got) != string(pt) {
+			t.Errorf("Decrypt3DSData() = %s, want %s", got, pt)
+		}
+		_, err = guard.Decrypt3DSData([]byte(jwe))
+		var decryptErr *DecryptError
+		if !errors.Is(err, ErrReplayDetected) || !errors.As(err, &decryptErr) || decryptErr.Stage != StageReplay || decryptErr.Kid != Kid(key) {
+			t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrReplayDetected)
+		}
+	})
+	t.Run("re-encoded header does not evade the store", func(t *testing.T) {
+		guard := NewReplayGuard(d, ReplayPolicy{Store: NewMemoryReplayStore()})
+		if _, err := guard.Decrypt3DSData([]byte(jwe)); err != nil {
+			t.Fatalf("Decrypt3DSData() error = %v", err)
+		}
+		parts := strings.Split(jwe, ".")
+		header, _ := base64Decoder.DecodeString(parts[headerIndex])
+		parts[headerIndex] = base64Decoder.EncodeToString(append([]byte(" "), header...))
+		if _, err := guard.Decrypt3DSData([]byte(strings.Join(parts, "."))); !errors.Is(err, ErrReplayDetected) {
+			t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrReplayDetected)
+		}
+	})
+	t.Run("stale credential is rejected", func(t *testing.T) {
+		guard := NewReplayGuard(d, ReplayPolicy{MaxAge: time.Minute, Now: clock(time.Hour)})
+		if _, err := guard.Decrypt3DSData([]byte(jwe)); !errors.Is(err, ErrStaleCredential) {
+			t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrStaleCredential)
+		}
+	})
+	t.Run("credential from the future is rejected", func(t *testing.T) {
+		guard := NewReplayGuard(d, ReplayPolicy{MaxFutureSkew: time.Minute, Now: clock(-time.Hour)})
+		if _, err := guard.Decrypt3DSData([]byte(jwe)); !errors.Is(err, ErrFutureCredential) {
+			t.Errorf("Decrypt3DSData() error = %v, want %v", err, ErrFutureCredential)
+		}
+	})
+	t.Run("rejected tokens are not recorded", func(t *testing.T) {
+		store := NewMemoryReplayStore()
+		stale := NewReplayGuard(d, ReplayPolicy{Now: clock(time.Hour), Store: store})
+		if _, err := stale.Decrypt3DSData([]byte(jwe)); !errors.Is(err, ErrStaleCredential) {
+			t.Fatalf("Decrypt3DSData() error = %v, want %v", err, ErrStaleCredential)
+		}
+		guard := NewReplayGuard(d, ReplayPolicy{Store: store})
+		if _, err := guard.Decrypt3DSData([]byte(jwe)); err != nil {
+			t.Errorf("Decrypt3DSData() error = %v", err)
+		}
+	})
+	t.Run("concurrent submissions are accepted once", func(t *testing.T) {
+		guard := NewReplayGuard(d, ReplayPolicy{Store: NewMemoryReplayStore()})
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := guard.Decrypt3DSData([]byte(jwe))
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		accepted := 0
+		for err := range errs {
+			if err == nil {
+				accepted++
+			} else if !errors.Is(err, ErrReplayDetected) {
+				t.Errorf("Decrypt3DSData() error = %v", err)
+			}
+		}
+		if accepted != 1 {
+			t.Errorf("accepted %d submissions, want 1", accepted)
+		}
+	})
+}
+
+func TestMemoryReplayStoreExpiry(t *testing.T) {
+	now := time.Now()
+	store := &memoryReplayStore{seen: make(map[string]time.Time), now: func() time.Time { return now }}
+	ctx := context.Background()
+	if seen, _ := store.CheckAndStore(ctx, "digest", time.Minute); seen {
+		t.Error("CheckAndStore() reported a new digest as seen")
+	}
+	if seen, _ := store.CheckAndStore(ctx, "digest", time.Minute); !seen {
+		t.Error("CheckAndStore() did not report a recorded digest")
+	}
+	now = now.Add(2 * time.Minute)
+	if seen, _ := store.CheckAndStore(ctx, "digest", time.Minute); seen {
+		t.Error("CheckAndStore() reported an expired digest as seen")
+	}
+	now = now.Add(2 * time.Minute)
+	store.CheckAndStore(ctx, "other", time.Minute)
+	if _, ok := store.seen["digest"]; ok {
+		t.Error("expired digest was not swept")
+	}
+}
@@ -0,0 +1,188 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redactedJWE replaces the compact JWEs found by the scrubber
+const redactedJWE = "[REDACTED JWE]"
+
+var (
+	// compactJWEPattern matches five base64url segments; the header is checked separately
+	compactJWEPattern = regexp.MustCompile(`[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+	// panPattern matches 12 to 19 digits, or 16 and 15 digits in the printed groups of 4-4-4-4 and 4-6-5
+	panPattern = regexp.MustCompile(`\b\d{4}[ -]\d{4}[ -]\d{4}[ -]\d{4}\b|\b\d{4}[ -]\d{6}[ -]\d{5}\b|\b\d{12,19}\b`)
+	// base64Pattern matches runs of standard base64 long enough to hold a 19-byte cryptogram
+	base64Pattern = regexp.MustCompile(`[A-Za-z0-9+/]{26,}={0,2}`)
+)
+
+// Scrub masks the compact JWEs, PANs and cryptograms found in `s`. JWEs are detected
+// by a header naming `alg` and `enc`, PANs by their IIN and Luhn check digit, and
+// cryptograms as base64 decoding to 19, 20 or 40 bytes. PANs keep their first 6 and
+// last 4 digits, see MaskPAN. It is a safety net for free text such as error messages
+// and request dumps; values known to be sensitive should not be logged in the first place.
+func Scrub(s string) string {
+	s = compactJWEPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if isJWEHeader(m[:strings.IndexByte(m, '.')]) {
+			return redactedJWE
+		}
+		return m
+	})
+	s = base64Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if isCryptogram(m) {
+			return redacted
+		}
+		return m
+	})
+	return panPattern.ReplaceAllStringFunc(s, func(m string) string {
+		pan := strings.NewReplacer(" ", "", "-", "").Replace(m)
+		if DetectBrand(pan) == BrandUnknown || ValidatePAN(pan) != nil {
+			return m
+		}
+		return MaskPAN(pan)
+	})
+}
+
+func isJWEHeader(segment string) bool {
+	raw, err := base64Decoder.DecodeString(segment)
+	if err != nil {
+		return false
+	}
+	var header map[string]any
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return false
+	}
+	_, alg := header["alg"]
+	_, enc := header["enc"]
+	return alg && enc
+}
+
+func isCryptogram(s string) bool {
+	// hex digests decode as base64 too, but never hold a cryptogram
+	if strings.Trim(s, "0123456789abcdefABCDEF") == "" {
+		return false
+	}
+	raw, err := decodeCryptogramBase64(s)
+	if err != nil {
+		return false
+	}
+	switch len(raw) {
+	case 19, 20, 40:
+		return true
+	}
+	return false
+}
+
+// NewScrubber returns a writer passing everything written to `w` through Scrub.
+// Each Write is scrubbed on its own, which suits log.Logger and the slog handlers
+// as they write one entry per call.
+func NewScrubber(w io.Writer) io.Writer {
+	return scrubber{w}
+}
+
+type scrubber struct {
+	w io.Writer
+}
+
+func (s scrubber) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(s.w, Scrub(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewScrubHandler wraps `h` so that the message and the attribute values of every
+// record pass through Scrub before reaching it. Attribute values of other kinds than
+// strings are formatted with %+v and replaced by the scrubbed text only if it or
+// their JSON encoding holds anything to scrub. Byte slices are scrubbed as text.
+func NewScrubHandler(h slog.Handler) slog.Handler {
+	return scrubHandler{h}
+}
+
+type scrubHandler struct {
+	h slog.Handler
+}
+
+func (s scrubHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.h.Enabled(ctx, level)
+}
+
+func (s scrubHandler) Handle(ctx context.Context, r slog.Record) error {
+	scrubbed := slog.NewRecord(r.Time, r.Level, Scrub(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		scrubbed.AddAttrs(scrubAttr(a))
+		return true
+	})
+	return s.h.Handle(ctx, scrubbed)
+}
+
+func (s scrubHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		scrubbed[i] = scrubAttr(a)
+	}
+	return scrubHandler{s.h.WithAttrs(scrubbed)}
+}
+
+func (s scrubHandler) WithGroup(name string) slog.Handler {
+	return scrubHandler{s.h.WithGroup(name)}
+}
+
+func scrubAttr(a slog.Attr) slog.Attr {
+	return slog.Attr{Key: a.Key, Value: scrubValue(a.Value.Resolve())}
+}
+
+func scrubValue(v slog.Value) slog.Value {
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.StringValue(Scrub(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		scrubbed := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			scrubbed[i] = scrubAttr(a)
+		}
+		return slog.GroupValue(scrubbed...)
+	case slog.KindAny, slog.KindInt64, slog.KindUint64:
+		switch b := v.Any().(type) {
+		case []byte:
+			return scrubBytes(v, b)
+		case json.RawMessage:
+			return scrubBytes(v, b)
+		}
+		s := fmt.Sprintf("%+v", v.Any())
+		scrubbed := Scrub(s)
+		// a JSON handler encodes the value with encoding/json rather than fmt, which
+		// shows the fields a String or Format method may hide
+		if scrubbed != s || v.Kind() == slog.KindAny && jsonLeaks(v.Any()) {
+			return slog.StringValue(scrubbed)
+		}
+	}
+	return v
+}
+
+// scrubBytes scrubs `b` as text, as a request body would be logged, rather than
+// as the decimal bytes %+v prints
+func scrubBytes(v slog.Value, b []byte) slog.Value {
+	if scrubbed := Scrub(string(b)); scrubbed != string(b) {
+		return slog.StringValue(scrubbed)
+	}
+	return v
+}
+
+// jsonLeaks reports whether the JSON encoding of `v` holds anything Scrub masks
+func jsonLeaks(v any) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return Scrub(string(b)) != string(b)
+}
+
+var _ slog.Handler = scrubHandler{}
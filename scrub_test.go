@@ -0,0 +1,139 @@
+package samsungpaycodec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockVisa(key, "106000", "USD")
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "compact JWE",
+			in:   "decrypting " + jwe + ": authentication failed",
+			want: "decrypting [REDACTED JWE]: authentication failed",
+		},
+		{
+			name: "dotted text that is not a JWE",
+			in:   "host a.b.c.d.e and version 1.2.3.4.5",
+			want: "host a.b.c.d.e and version 1.2.3.4.5",
+		},
+		{
+			name: "credential JSON",
+			in:   `{"amount":"106000","cryptogram":"AwAABCQACCDLHvYBtQ9EgUUQYaA=","currency_code":"USD","eci_indicator":"05","tokenPanExpiration":"1127","utc":"1700557639934","tokenPAN":"4558386640000312"}`,
+			want: `{"amount":"106000","cryptogram":"[REDACTED]","currency_code":"USD","eci_indicator":"05","tokenPanExpiration":"1127","utc":"1700557639934","tokenPAN":"455838******0312"}`,
+		},
+		{
+			name: "19-byte and 40-byte cryptograms",
+			in:   "ucaf=AILsL+OF38dxAAQSUy+FAoACFA== dsrp=" + testCryptogram,
+			want: "ucaf=[REDACTED] dsrp=[REDACTED]",
+		},
+		{
+			name: "grouped PANs",
+			in:   "card 5123 4567 8901 2346 or 3403-532780-80900",
+			want: "card 512345******2346 or 340353*****0900",
+		},
+		{
+			name: "numbers that are not PANs",
+			in:   "order 5123456789012345 at 1700557639934",
+			want: "order 5123456789012345 at 1700557639934",
+		},
+		{
+			name: "hex digest",
+			in:   "sha256 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			want: "sha256 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Scrub(tt.in); got != tt.want {
+				t.Errorf("Scrub() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrubber(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New(NewScrubber(&out), "", 0)
+	logger.Printf("charging %s", mastercardTestCard.dpan)
+	if got, want := out.String(), "charging 512345******2346\n"; got != want {
+		t.Errorf("scrubbed log = %q, want %q", got, want)
+	}
+}
+
+func TestScrubHandler(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "106000", "USD")
+
+	var out bytes.Buffer
+	logger := slog.New(NewScrubHandler(slog.NewJSONHandler(&out, nil))).With("pan", mastercardTestCard.dpan)
+	logger.WithGroup("request").Error("decrypting "+jwe,
+		"err", fmt.Errorf("token %s: %w", jwe, errors.New("boom")),
+		"cryptogram", testCryptogram,
+		"pan_number", int64(5123456789012346),
+		"amount", 106000,
+		slog.Group("card", "dpan", visaTestCard.dpan),
+	)
+	got := out.String()
+	for _, secret := range []string{jwe, mastercardTestCard.dpan, visaTestCard.dpan, testCryptogram} {
+		if strings.Contains(got, secret) {
+			t.Errorf("scrubbed record contains %s: %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, `"amount":106000`) {
+		t.Errorf("scrubbed record changed non-sensitive values: %s", got)
+	}
+}
+
+// opaqueCard hides its PAN from fmt, but not from encoding/json
+type opaqueCard struct {
+	PAN string
+}
+
+func (opaqueCard) String() string { return "card" }
+
+func TestScrubHandlerValues(t *testing.T) {
+	pc := mockCredential(mastercardTestCard, "106000", "USD")
+	plain, _ := json.Marshal(credentialWire(pc))
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{name: "[]byte body", value: plain},
+		{name: "json.RawMessage body", value: json.RawMessage(plain)},
+		{name: "struct wrapping a credential", value: struct{ C PaymentCredential }{pc}},
+		{name: "PAN hidden from fmt only", value: opaqueCard{PAN: mastercardTestCard.dpan}},
+	}
+	handlers := map[string]func(io.Writer) slog.Handler{
+		"text": func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, nil) },
+		"json": func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, nil) },
+	}
+	for _, tt := range tests {
+		for name, newHandler := range handlers {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				var out bytes.Buffer
+				slog.New(NewScrubHandler(newHandler(&out))).Info("request", "body", tt.value)
+				got := out.String()
+				for _, secret := range []string{mastercardTestCard.dpan, testCryptogram, base64.StdEncoding.EncodeToString(plain)} {
+					if strings.Contains(got, secret) {
+						t.Errorf("scrubbed record contains %s: %s", secret, got)
+					}
+				}
+			})
+		}
+	}
+}
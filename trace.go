@@ -0,0 +1,148 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"errors"
+)
+
+// Tracer starts the spans of the decryptions. It mirrors the Start method of the
+// OpenTelemetry trace.Tracer, so an adapter only converts the attributes. The
+// context returned by Start is carried to the KeyProvider, so the spans of a
+// context-aware provider nest under the key lookup.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute annotates a span. The attributes set by the decryptor never carry
+// sensitive values: only the version, the header values and the outcome.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Attribute keys set by the decryptor
+const (
+	AttrVersion = "samsungpay.version"
+	AttrKid     = "jwe.kid"
+	AttrAlg     = "jwe.alg"
+	AttrEnc     = "jwe.enc"
+	// AttrBrand is the brand of the decrypted credential, set on the decrypt span
+	AttrBrand = "samsungpay.brand"
+	// AttrStage is the stage of a failure, set on the decrypt span
+	AttrStage = "samsungpay.stage"
+	// AttrHeaderAuthenticated is "true" if the content encryption authenticated the
+	// protected header, set on the decrypt span of a success
+	AttrHeaderAuthenticated = "jwe.header_authenticated"
+)
+
+// SpanDecrypt is the name of the span of a whole decryption. Its children are named
+// after the stages, e.g. "samsungpay.key_lookup" for StageKeyLookup.
+const SpanDecrypt = "samsungpay.decrypt"
+
+const (
+	spanParse          = "samsungpay." + string(StageParse)
+	spanKeyLookup      = "samsungpay." + string(StageKeyLookup)
+	spanKeyUnwrap      = "samsungpay." + string(StageKeyUnwrap)
+	spanContentDecrypt = "samsungpay." + string(StageContentDecrypt)
+	spanValidate       = "samsungpay." + string(StageValidate)
+)
+
+// WithTracer opens a span for each decryption, with children for the parsing, the
+// key lookup, the key unwrap, the content decryption and, with WithExpiryCheck,
+// the validation.
+func WithTracer(t Tracer) DecryptorOption {
+	return func(c *decryptorConfig) {
+		c.tracer = t
+	}
+}
+
+// spanAttrs holds the attribute values by value, so no attributes are allocated
+// unless a tracer is configured
+type spanAttrs struct {
+	version, kid, alg, enc string
+}
+
+func (a spanAttrs) list() []Attribute {
+	attrs := make([]Attribute, 0, 4)
+	for _, attr := range []Attribute{{AttrVersion, a.version}, {AttrKid, a.kid}, {AttrAlg, a.alg}, {AttrEnc, a.enc}} {
+		if attr.Value != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+func (c decryptorConfig) startSpan(ctx context.Context, name string, attrs spanAttrs) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return c.tracer.Start(ctx, name, attrs.list()...)
+}
+
+// endSpan records the redacted form of `err`, if any, and ends the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(redactSpanError(err))
+	}
+	span.End()
+}
+
+// spanSentinels are the errors a span error may name
+var spanSentinels = []error{
+	ErrMalformedToken, ErrUnsupportedAlgorithm, ErrHeaderPolicy, ErrKeyNotFound,
+	ErrInvalidKey, ErrKeyUnwrapFailed, ErrAuthenticationFailed, ErrMalformedCredential,
+	ErrTokenExpired, context.Canceled, context.DeadlineExceeded,
+}
+
+// spanError is the error recorded on spans: the stage and the sentinel error of a
+// failure, without the detail, which may quote the decrypted credential
+type spanError struct {
+	stage    Stage
+	sentinel error
+}
+
+// redactSpanError reduces `err` to its stage and sentinel error
+func redactSpanError(err error) error {
+	var e spanError
+	var de *DecryptError
+	if errors.As(err, &de) {
+		e.stage = de.Stage
+	}
+	for _, sentinel := range spanSentinels {
+		if errors.Is(err, sentinel) {
+			e.sentinel = sentinel
+			break
+		}
+	}
+	return e
+}
+
+func (e spanError) Error() string {
+	msg := "decryption failed"
+	if e.sentinel != nil {
+		msg = e.sentinel.Error()
+	}
+	if e.stage == "" {
+		return msg
+	}
+	return string(e.stage) + ": " + msg
+}
+
+func (e spanError) Unwrap() error {
+	return e.sentinel
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+var _ Span = noopSpan{}
@@ -0,0 +1,170 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedSpan is a span kept by recordingTracer
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]string
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+type spanKey struct{}
+
+// recordingTracer keeps the spans it starts, linking them through the context
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	s := &recordedSpan{name: name, parent: parent, attrs: make(map[string]string)}
+	s.SetAttributes(attrs...)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) names() []string {
+	var names []string
+	for _, s := range t.spans {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// spanCheckingProvider records the span in the context of its lookups
+type spanCheckingProvider struct {
+	KeyProvider
+	span **recordedSpan
+}
+
+func (p spanCheckingProvider) GetKeyContext(ctx context.Context, kid string) (PrivateKey, error) {
+	*p.span, _ = ctx.Value(spanKey{}).(*recordedSpan)
+	return getKeyContext(ctx, p.KeyProvider, kid)
+}
+
+func TestWithTracer(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockVisa(key, "106000", "USD")
+	parts := strings.Split(jwe, ".")
+	parts[encryptionKeyIndex] = parts[encryptionKeyIndex][:len(parts[encryptionKeyIndex])/2]
+	shortKey := strings.Join(parts, ".")
+	pc := mockCredential(visaTestCard, "106000", "USD")
+	pc.TokenPanExpiration = "1399"
+	badExpiry, _ := mockJWE(mockHeader(&key.PublicKey), &key.PublicKey, pc)
+	tests := []struct {
+		name      string
+		provider  KeyProvider
+		payload   string
+		wantSpans []string
+		wantStage string
+		wantErr   string
+	}{
+		{
+			name:      "success",
+			provider:  NewMemoryKeyProvider(key),
+			wantSpans: []string{SpanDecrypt, "samsungpay.parse", "samsungpay.key_lookup", "samsungpay.key_unwrap", "samsungpay.content_decrypt", "samsungpay.validate"},
+		},
+		{
+			name:      "missing key",
+			provider:  NewMemoryKeyProvider(),
+			wantSpans: []string{SpanDecrypt, "samsungpay.parse", "samsungpay.key_lookup"},
+			wantStage: "key_lookup",
+			wantErr:   "key_lookup: key not found",
+		},
+		{
+			name:      "encrypted key of the wrong size",
+			provider:  NewMemoryKeyProvider(key),
+			payload:   shortKey,
+			wantSpans: []string{SpanDecrypt, "samsungpay.parse", "samsungpay.key_lookup", "samsungpay.key_unwrap"},
+			wantStage: "key_unwrap",
+			wantErr:   "key_unwrap: malformed token",
+		},
+		{
+			name:      "invalid credential",
+			provider:  NewMemoryKeyProvider(key),
+			payload:   badExpiry,
+			wantSpans: []string{SpanDecrypt, "samsungpay.parse", "samsungpay.key_lookup", "samsungpay.key_unwrap", "samsungpay.content_decrypt", "samsungpay.validate"},
+			wantStage: "validate",
+			wantErr:   "validate: malformed payment credential",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			var lookupSpan *recordedSpan
+			provider := spanCheckingProvider{tt.provider, &lookupSpan}
+			d := must(NewJWEDecryptor("100", provider, WithTracer(tracer), WithExpiryCheck(nil)))
+			payload := jwe
+			if tt.payload != "" {
+				payload = tt.payload
+			}
+			_, err := d.Decrypt3DSData([]byte(payload))
+			if (err != nil) != (tt.wantStage != "") {
+				t.Fatalf("Decrypt3DSData() error = %v", err)
+			}
+			if got := strings.Join(tracer.names(), ","); got != strings.Join(tt.wantSpans, ",") {
+				t.Fatalf("spans = %s, want %s", got, strings.Join(tt.wantSpans, ","))
+			}
+
+			root := tracer.spans[0]
+			for _, s := range tracer.spans {
+				if !s.ended {
+					t.Errorf("span %s was not ended", s.name)
+				}
+				if s != root && s.parent != root {
+					t.Errorf("span %s is not a child of %s", s.name, SpanDecrypt)
+				}
+				if s != tracer.spans[1] && (s.attrs[AttrKid] != Kid(key) || s.attrs[AttrAlg] != AlgRSA1_5 || s.attrs[AttrEnc] != EncA128GCM) {
+					t.Errorf("span %s attributes = %v", s.name, s.attrs)
+				}
+				if s.attrs[AttrVersion] != "100" {
+					t.Errorf("span %s has version %s", s.name, s.attrs[AttrVersion])
+				}
+				for _, v := range s.attrs {
+					if strings.Contains(v, visaTestCard.dpan) || strings.Contains(v, testCryptogram) {
+						t.Errorf("span %s carries a sensitive value: %v", s.name, s.attrs)
+					}
+				}
+			}
+			if lookupSpan == nil || lookupSpan.name != "samsungpay.key_lookup" {
+				t.Errorf("provider looked up the key within span %v", lookupSpan)
+			}
+
+			last := tracer.spans[len(tracer.spans)-1]
+			if tt.wantStage == "" {
+				if root.err != nil || root.attrs[AttrBrand] != "visa" {
+					t.Errorf("%s error = %v, attributes = %v", SpanDecrypt, root.err, root.attrs)
+				}
+				return
+			}
+			// the span errors are reduced to the stage and sentinel, with no detail of the credential
+			if root.err == nil || root.err.Error() != tt.wantErr || last.err == nil || last.err.Error() != tt.wantErr || root.attrs[AttrStage] != tt.wantStage {
+				t.Errorf("%s error = %v, %s error = %v, stage %s", SpanDecrypt, root.err, last.name, last.err, root.attrs[AttrStage])
+			}
+			if sentinel := errors.Unwrap(root.err); sentinel == nil || !errors.Is(err, sentinel) {
+				t.Errorf("%s error = %v does not unwrap to the sentinel of %v", SpanDecrypt, root.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package samsungpaycodec
+
+import (
+	"crypto/rsa"
+	"io"
+	"math/big"
+)
+
+// Wipe resets the credential to its zero value, so its sensitive values are no
+// longer reachable from it. Go strings are immutable and may have been copied, so
+// their memory cannot be guaranteed to be zeroed; the garbage collector reclaims
+// it in time. To control the lifetime of the plaintext, decrypt it with
+// AppendDecryptor.DecryptTo into a buffer that is cleared once parsed.
+func (c *PaymentCredential) Wipe() {
+	*c = PaymentCredential{}
+}
+
+// wipeKey zeroes the private values of RSA keys in place. Keys of other types,
+// e.g. handles of HSM keys, hold no key material to wipe.
+func wipeKey(key PrivateKey) {
+	k, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return
+	}
+	zeroInt(k.D)
+	for _, p := range k.Primes {
+		zeroInt(p)
+	}
+	zeroInt(k.Precomputed.Dp)
+	zeroInt(k.Precomputed.Dq)
+	zeroInt(k.Precomputed.Qinv)
+	for _, v := range k.Precomputed.CRTValues {
+		zeroInt(v.Exp)
+		zeroInt(v.Coeff)
+		zeroInt(v.R)
+	}
+}
+
+// zeroInt overwrites the words backing `i` before setting it to zero, as SetInt64
+// alone would leave the previous value in the spare capacity.
+func zeroInt(i *big.Int) {
+	if i == nil {
+		return
+	}
+	clear(i.Bits())
+	i.SetInt64(0)
+}
+
+// wipeKeys wipes and removes the keys of a provider, the caller holding its lock.
+// The copies the standard library keeps for its constant-time arithmetic are
+// beyond its reach.
+func wipeKeys(keys map[string]PrivateKey) {
+	for kid, key := range keys {
+		wipeKey(key)
+		delete(keys, kid)
+	}
+}
+
+// Close wipes the RSA keys held by the provider and removes them, after which the
+// provider finds no keys. The keys given to NewMemoryKeyProvider or AddKey are
+// wiped in place, so they must not be in use elsewhere.
+func (p *memoryProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	wipeKeys(p.keys)
+	return nil
+}
+
+// Close wipes the RSA keys parsed from the files and removes them, after which the
+// provider finds no keys. The files are left untouched.
+func (p *filesystemKeyProvider) Close() error {
+	p.kidMu.Lock()
+	defer p.kidMu.Unlock()
+	wipeKeys(p.keys)
+	return nil
+}
+
+var _ io.Closer = &memoryProvider{}
+var _ io.Closer = &filesystemKeyProvider{}
@@ -0,0 +1,121 @@
+package samsungpaycodec
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestPaymentCredentialWipe(t *testing.T) {
+	pc := mockCredential(visaTestCard, "106000", "USD")
+	pc.Wipe()
+	if pc != (PaymentCredential{}) {
+		t.Errorf("Wipe() left %#v", pc)
+	}
+}
+
+func TestKeyProviderClose(t *testing.T) {
+	providers := map[string]func() KeyProvider{
+		"memory": func() KeyProvider { return NewMemoryKeyProvider(getKey()) },
+		"filesystem": func() KeyProvider {
+			return mustProvider(NewFilesystemKeyProvider("testdata/fs/single-key"))
+		},
+	}
+	for name, newProvider := range providers {
+		t.Run(name, func(t *testing.T) {
+			p := newProvider()
+			kid := Kid(getKey())
+			key := p.GetKey(kid).(*rsa.PrivateKey)
+			secrets := []*big.Int{key.D, key.Primes[0], key.Primes[1], key.Precomputed.Dp, key.Precomputed.Qinv}
+			var words [][]big.Word
+			for _, s := range secrets {
+				words = append(words, s.Bits())
+			}
+
+			if err := p.(io.Closer).Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			for i, w := range words {
+				for _, word := range w {
+					if word != 0 {
+						t.Fatalf("Close() left the words of secret %d", i)
+					}
+				}
+			}
+			if secrets[0].Sign() != 0 {
+				t.Errorf("Close() left D = %s", secrets[0])
+			}
+			if _, err := p.(ContextKeyProvider).GetKeyContext(context.Background(), kid); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("GetKeyContext() error = %v after Close(), want %v", err, ErrKeyNotFound)
+			}
+		})
+	}
+}
+
+func TestImplicitRejectWipesRejectedKey(t *testing.T) {
+	rejected := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	cek, err := implicitReject(rejected, nil)(16)
+	if err != nil || len(cek) != 16 {
+		t.Fatalf("implicitReject() = %x, %v", cek, err)
+	}
+	for _, b := range rejected {
+		if b != 0 {
+			t.Fatalf("implicitReject() left the rejected key %x", rejected)
+		}
+	}
+}
+
+// allZero reports whether `b` holds no plaintext
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRejectedPlaintextIsCleared(t *testing.T) {
+	key := getRSAKey()
+	jwe, _ := GetMockMastercard(key, "100", "SAR")
+
+	t.Run("expired token", func(t *testing.T) {
+		d := must(NewJWEDecryptor("100", NewMemoryKeyProvider(key), WithExpiryCheck(func() time.Time {
+			return time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+		}))).(AppendDecryptor)
+		buf := make([]byte, 0, 4096)
+		if _, err := d.DecryptTo(buf, []byte(jwe)); !errors.Is(err, ErrTokenExpired) {
+			t.Fatalf("DecryptTo() error = %v, want %v", err, ErrTokenExpired)
+		}
+		if !allZero(buf[:cap(buf)]) {
+			t.Error("DecryptTo() left the plaintext of an expired token in dst")
+		}
+	})
+
+	t.Run("replayed token", func(t *testing.T) {
+		pc := mockCredential(mastercardTestCard, "100", "SAR")
+		pc.Utc = "1000"
+		plain, _ := json.Marshal(credentialWire(pc))
+		g := NewReplayGuard(stubDecryptor{plain}, ReplayPolicy{})
+		if _, err := g.Decrypt3DSData([]byte(jwe)); !errors.Is(err, ErrStaleCredential) {
+			t.Fatalf("Decrypt3DSData() error = %v, want %v", err, ErrStaleCredential)
+		}
+		if !allZero(plain) {
+			t.Error("Decrypt3DSData() left the plaintext of a stale token")
+		}
+	})
+}
+
+// stubDecryptor returns its plaintext as-is, so the caller sees what is done to it
+type stubDecryptor struct {
+	plain []byte
+}
+
+func (d stubDecryptor) Decrypt3DSData([]byte) ([]byte, error) {
+	return d.plain, nil
+}